@@ -0,0 +1,218 @@
+package venstar
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+type authChallenge struct {
+	scheme string
+	params map[string]string
+	count  int
+}
+
+func parseChallenge(header string) *authChallenge {
+	header = strings.TrimSpace(header)
+	scheme, rest, _ := strings.Cut(header, " ")
+	challenge := &authChallenge{
+		scheme: strings.ToLower(scheme),
+		params: map[string]string{},
+	}
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		key, val, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimLeft(val, " ")
+		if strings.HasPrefix(val, `"`) {
+			var sb strings.Builder
+			i := 1
+			for ; i < len(val) && val[i] != '"'; i++ {
+				if val[i] == '\\' && i+1 < len(val) {
+					i++
+				}
+				sb.WriteByte(val[i])
+			}
+			challenge.params[key] = sb.String()
+			if i < len(val) {
+				i++
+			}
+			rest = val[i:]
+		} else {
+			v, r, _ := strings.Cut(val, ",")
+			challenge.params[key] = strings.TrimSpace(v)
+			rest = r
+		}
+	}
+	return challenge
+}
+
+// setChallenge records the best authentication challenge offered,
+// returning false if none of them is supported.
+func (dev *Device) setChallenge(headers []string) bool {
+	var basic, digest *authChallenge
+	for _, header := range headers {
+		challenge := parseChallenge(header)
+		switch challenge.scheme {
+		case "digest":
+			if digest == nil {
+				digest = challenge
+			}
+		case "basic":
+			if basic == nil {
+				basic = challenge
+			}
+		}
+	}
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	switch {
+	case digest != nil:
+		dev.challenge = digest
+	case basic != nil:
+		dev.challenge = basic
+	default:
+		return false
+	}
+	return true
+}
+
+func (dev *Device) authorize(req *http.Request) {
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	if dev.challenge == nil {
+		return
+	}
+	switch dev.challenge.scheme {
+	case "basic":
+		req.SetBasicAuth(dev.username, dev.password)
+	case "digest":
+		dev.challenge.count++
+		req.Header.Set("Authorization", dev.challenge.digest(req, dev.username, dev.password))
+	}
+}
+
+func (challenge *authChallenge) digest(req *http.Request, username, password string) string {
+	algorithm := challenge.params["algorithm"]
+	var newHash func() hash.Hash
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		newHash = md5.New
+	}
+	h := func(parts ...string) string {
+		hh := newHash()
+		io.WriteString(hh, strings.Join(parts, ":"))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	realm := challenge.params["realm"]
+	nonce := challenge.params["nonce"]
+	uri := req.URL.RequestURI()
+	cnonce := newNonce()
+	nc := fmt.Sprintf("%08x", challenge.count)
+	ha1 := h(username, realm, password)
+	if strings.HasSuffix(strings.ToLower(algorithm), "-sess") {
+		ha1 = h(ha1, nonce, cnonce)
+	}
+	ha2 := h(req.Method, uri)
+	var qop string
+	for _, q := range strings.Split(challenge.params["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	var response string
+	if qop != "" {
+		response = h(ha1, nonce, nc, cnonce, qop, ha2)
+	} else {
+		response = h(ha1, nonce, ha2)
+	}
+	parts := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", realm),
+		fmt.Sprintf("nonce=%q", nonce),
+		fmt.Sprintf("uri=%q", uri),
+		fmt.Sprintf("response=%q", response),
+	}
+	if algorithm != "" {
+		parts = append(parts, "algorithm="+algorithm)
+	}
+	if opaque, ok := challenge.params["opaque"]; ok {
+		parts = append(parts, fmt.Sprintf("opaque=%q", opaque))
+	}
+	if qop != "" {
+		parts = append(parts, "qop="+qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+	return "Digest " + strings.Join(parts, ", ")
+}
+
+func newNonce() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func cloneRequest(req *http.Request, u *url.URL) (*http.Request, error) {
+	retry := req.Clone(req.Context())
+	retry.URL = u
+	retry.Host = ""
+	retry.Header.Del("Authorization")
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errors.New("request body cannot be replayed")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	return retry, nil
+}
+
+// wantsHTTPS reports whether res is a server's complaint about a plain
+// http request sent to its https port, which servers answer with 400 Bad
+// Request and a message naming HTTPS or SSL.
+func wantsHTTPS(res *http.Response) bool {
+	if res.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	body := strings.ToLower(string(bufferBody(res)))
+	return strings.Contains(body, "https") || strings.Contains(body, "ssl")
+}
+
+// bufferBody reads the start of an error response body and replaces the
+// body so it can still be read by the caller.
+func bufferBody(res *http.Response) []byte {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+// isRefused reports whether err means the request never reached the
+// device, so it is safe to send again over https.
+func isRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// isDropped reports whether the device closed the connection after the
+// request was sent, as some https ports do with plain http. Only requests
+// without side effects may be sent again after this.
+func isDropped(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,56 @@
+package venstar_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  venstartest.Option
+	}{
+		{"basic", venstartest.WithBasicAuth("admin", "secret")},
+		{"digest", venstartest.WithDigestAuth("admin", "secret")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := venstartest.NewServer(tt.opt, venstartest.WithName("HALL"))
+			defer srv.Close()
+			dev, err := venstar.Open(srv.URL, venstar.WithCredentials("admin", "secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dev.Name != "HALL" {
+				t.Errorf("Name = %q, want HALL", dev.Name)
+			}
+			// a post exercises replaying the body after the challenge
+			err = dev.SetFanMode(venstar.FanSettingOn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fan := srv.Info().FanSetting; fan != venstar.FanSettingOn {
+				t.Errorf("FanSetting = %v, want on", fan)
+			}
+		})
+	}
+}
+
+func TestAuthWrongPassword(t *testing.T) {
+	for _, opt := range []venstartest.Option{
+		venstartest.WithBasicAuth("admin", "secret"),
+		venstartest.WithDigestAuth("admin", "secret"),
+	} {
+		srv := venstartest.NewServer(opt)
+		_, err := venstar.Open(srv.URL, venstar.WithCredentials("admin", "wrong"))
+		var herr *venstar.HTTPError
+		if !errors.As(err, &herr) || herr.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Open with wrong password = %v, want 401 *HTTPError", err)
+		}
+		srv.Close()
+	}
+}
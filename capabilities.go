@@ -0,0 +1,141 @@
+package venstar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type DeviceType string
+
+const (
+	DeviceTypeResidential DeviceType = "residential"
+	DeviceTypeCommercial  DeviceType = "commercial"
+)
+
+// Capabilities is the device description reported by the root API
+// endpoint.
+type Capabilities struct {
+	APIVersion int                        `json:"api_ver"`
+	Type       DeviceType                 `json:"type"`
+	Model      string                     `json:"model"`
+	Firmware   string                     `json:"firmware"`
+	Extra      map[string]json.RawMessage `json:"-"`
+}
+
+func (caps *Capabilities) UnmarshalJSON(data []byte) error {
+	type capabilities Capabilities
+	var v capabilities
+	extra, err := unmarshalExtra(data, &v)
+	if err != nil {
+		return err
+	}
+	*caps = Capabilities(v)
+	caps.Extra = extra
+	return nil
+}
+
+func (caps *Capabilities) String() string {
+	s := fmt.Sprintf("%s %s thermostat (api v%d", caps.Model, caps.Type, caps.APIVersion)
+	if caps.Firmware != "" {
+		s += ", firmware " + caps.Firmware
+	}
+	return strings.TrimSpace(s) + ")"
+}
+
+func (caps *Capabilities) Residential() bool {
+	return strings.EqualFold(string(caps.Type), string(DeviceTypeResidential))
+}
+
+func (caps *Capabilities) Commercial() bool {
+	return strings.EqualFold(string(caps.Type), string(DeviceTypeCommercial))
+}
+
+// HasHumidityControl reports whether the humidify and dehumidify
+// setpoints can be written. Only ColorTouch models have them.
+func (caps *Capabilities) HasHumidityControl() bool {
+	return caps.APIVersion >= 5 && strings.Contains(strings.ToUpper(caps.Model), "COLORTOUCH")
+}
+
+func (caps *Capabilities) HasAway() bool {
+	return caps.Residential()
+}
+
+// HasOccupancyControl reports whether the commercial holiday, override
+// and force unoccupied states can be written.
+func (caps *Capabilities) HasOccupancyControl() bool {
+	return caps.Commercial()
+}
+
+func (caps *Capabilities) HasIAQSensors() bool {
+	return caps.APIVersion >= 7
+}
+
+func (caps *Capabilities) HasHTTPS() bool {
+	return caps.APIVersion >= 6
+}
+
+func (dev *Device) Capabilities() (*Capabilities, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.CapabilitiesContext(ctx)
+}
+
+// CapabilitiesContext queries the root API endpoint the first time it is
+// called and returns the cached result after that.
+func (dev *Device) CapabilitiesContext(ctx context.Context) (*Capabilities, error) {
+	dev.mu.Lock()
+	caps := dev.caps
+	dev.mu.Unlock()
+	if caps != nil {
+		return caps, nil
+	}
+	caps = &Capabilities{}
+	err := dev.get(ctx, nil, caps)
+	if err != nil {
+		return nil, err
+	}
+	if caps.APIVersion == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotThermostat, dev.URL())
+	}
+	dev.mu.Lock()
+	dev.caps = caps
+	dev.mu.Unlock()
+	return caps, nil
+}
+
+func (dev *Device) require(ctx context.Context, feature string, supported func(*Capabilities) bool) error {
+	caps, err := dev.CapabilitiesContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting device capabilities: %w", err)
+	}
+	if !supported(caps) {
+		return &UnsupportedError{Feature: feature, Capabilities: caps}
+	}
+	return nil
+}
+
+// requireSettings checks the capabilities needed to change the given
+// groups of settings.
+func (dev *Device) requireSettings(ctx context.Context, humidity, away, occupancy bool) error {
+	if humidity {
+		err := dev.require(ctx, "humidity control", (*Capabilities).HasHumidityControl)
+		if err != nil {
+			return err
+		}
+	}
+	if away {
+		err := dev.require(ctx, "away mode", (*Capabilities).HasAway)
+		if err != nil {
+			return err
+		}
+	}
+	if occupancy {
+		err := dev.require(ctx, "occupancy control", (*Capabilities).HasOccupancyControl)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package venstar_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestCapabilities(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithAPIVersion(6), venstartest.WithFirmware("5.28"))
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps, err := dev.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.APIVersion != 6 || caps.Model != "COLORTOUCH" || caps.Firmware != "5.28" || !caps.Residential() {
+		t.Errorf("Capabilities() = %s", caps)
+	}
+	if !caps.HasHumidityControl() || !caps.HasHTTPS() || caps.HasIAQSensors() || caps.HasOccupancyControl() {
+		t.Errorf("wrong features for %s", caps)
+	}
+	// capabilities are probed once and cached
+	if _, err := dev.Capabilities(); err != nil {
+		t.Fatal(err)
+	}
+	probes := 0
+	for _, req := range srv.Requests() {
+		if req == "GET /" {
+			probes++
+		}
+	}
+	if probes != 1 {
+		t.Errorf("root endpoint queried %d times, want 1", probes)
+	}
+}
+
+func TestHumidityGating(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []venstartest.Option
+		supported bool
+	}{
+		{"colortouch", nil, true},
+		{"explorer", []venstartest.Option{venstartest.WithModel("EXPLORER")}, false},
+		{"old api", []venstartest.Option{venstartest.WithAPIVersion(4)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := venstartest.NewServer(tt.opts...)
+			defer srv.Close()
+			dev, err := venstar.Open(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = dev.SetHumidifySetpoint(45)
+			if tt.supported {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if hum := srv.Info().HumidifySetpoint; hum != 45 {
+					t.Errorf("HumidifySetpoint = %g, want 45", hum)
+				}
+				return
+			}
+			var uerr *venstar.UnsupportedError
+			if !errors.Is(err, venstar.ErrUnsupported) || !errors.As(err, &uerr) || uerr.Feature != "humidity control" {
+				t.Errorf("SetHumidifySetpoint = %v, want unsupported humidity control", err)
+			}
+			if n := len(srv.Forms("/settings")); n != 0 {
+				t.Errorf("%d settings writes, want none", n)
+			}
+		})
+	}
+}
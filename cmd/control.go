@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"math"
-	"strings"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/rclancey/venstar"
@@ -13,6 +15,7 @@ import (
 
 type argsType struct {
 	zone     string
+	registry string
 	heatTemp float64
 	coolTemp float64
 }
@@ -20,56 +23,63 @@ type argsType struct {
 func parseArgs() argsType {
 	var args argsType
 	flag.StringVar(&args.zone, "zone", "", "thermostat to control")
+	flag.StringVar(&args.registry, "registry", defaultRegistry(), "file caching known thermostats")
 	flag.Float64Var(&args.heatTemp, "heat", math.NaN(), "threshold temp for heating")
 	flag.Float64Var(&args.coolTemp, "cool", math.NaN(), "threshold temp for cooling")
 	flag.Parse()
 	return args
 }
 
-func main() {
-	args := parseArgs()
-	ch, err := venstar.Discover(2*time.Second)
+func defaultRegistry() string {
+	dir, err := os.UserCacheDir()
 	if err != nil {
-		log.Fatal(err)
+		return ".venstar.json"
 	}
+	return filepath.Join(dir, "venstar", "devices.json")
+}
+
+func main() {
+	args := parseArgs()
 	if args.zone == "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		devs, err := venstar.DiscoverAll(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
 		fmt.Println("Known thermostat zones:")
-		for {
-			dev, ok := <-ch
-			if !ok || dev == nil {
-				break
-			}
+		for _, dev := range devs {
 			fmt.Println("  ", dev.Name)
 		}
 	} else {
-		for {
-			dev, ok := <-ch
-			if !ok || dev == nil {
-				break
-			}
-			if strings.ToLower(dev.Name) != strings.ToLower(args.zone) {
-				continue
-			}
-			if !math.IsNaN(args.heatTemp) {
-				if !math.IsNaN(args.coolTemp) {
-					err = dev.SetHeatCoolTemps(args.heatTemp, args.coolTemp)
-				} else {
-					err = dev.SetHeatTemp(args.heatTemp)
-				}
-			} else if !math.IsNaN(args.coolTemp) {
-				err = dev.SetCoolTemp(args.coolTemp)
-			}
-			if err != nil {
-				log.Fatal(err)
-			}
-			info, err := dev.Info()
-			if err != nil {
-				log.Fatal(err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		reg, err := venstar.OpenRegistry(args.registry)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dev, err := reg.FindByName(ctx, args.zone)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !math.IsNaN(args.heatTemp) {
+			if !math.IsNaN(args.coolTemp) {
+				err = dev.SetHeatCoolTemps(args.heatTemp, args.coolTemp)
+			} else {
+				err = dev.SetHeatTemp(args.heatTemp)
 			}
-			fmt.Println("Current Temp:", info.SpaceTemp)
-			fmt.Println("Heat Temp:", info.HeatTemp)
-			fmt.Println("Cool Temp:", info.CoolTemp)
-			break
+		} else if !math.IsNaN(args.coolTemp) {
+			err = dev.SetCoolTemp(args.coolTemp)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		info, err := dev.Info()
+		if err != nil {
+			log.Fatal(err)
 		}
+		fmt.Println("Current Temp:", info.SpaceTemp)
+		fmt.Println("Heat Temp:", info.HeatTemp)
+		fmt.Println("Cool Temp:", info.CoolTemp)
 	}
 }
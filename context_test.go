@@ -0,0 +1,74 @@
+package venstar_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestContextCancel(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = dev.InfoContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("InfoContext = %v, want context.Canceled", err)
+	}
+	err = dev.SetModeContext(ctx, venstar.ModeHeat)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SetModeContext = %v, want context.Canceled", err)
+	}
+	if n := len(srv.Forms("/control")); n != 0 {
+		t.Errorf("%d writes with a canceled context", n)
+	}
+
+	// a slow device is abandoned when the deadline passes
+	srv.SetLatency(time.Second)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = dev.SensorsContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SensorsContext = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("SensorsContext took %s with a 50ms deadline", elapsed)
+	}
+}
+
+func TestDiscoverContext(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithName("HALL"))
+	defer srv.Close()
+	r, err := venstartest.NewSSDPResponder(srv.SSDPResponse("00:23:75:aa:bb:cc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	d := &venstar.Discoverer{Target: r.Addr()}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	ch, err := d.Discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []*venstar.Device
+	for dev := range ch {
+		found = append(found, dev)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("discovery ran %s past its 200ms deadline", elapsed)
+	}
+	if len(found) != 1 || found[0].Name != "HALL" {
+		t.Errorf("found %v, want HALL", found)
+	}
+}
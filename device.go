@@ -3,166 +3,329 @@ package venstar
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"reflect"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+var DefaultTimeout = 10 * time.Second
+
+func defaultContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), DefaultTimeout)
+}
+
 type Device struct {
+	// BaseURL is where the device was found. The device may move it, to
+	// https or to a new address found by its resolver, so once the device
+	// is in use read it with URL and do not write it.
 	BaseURL *url.URL
 	Name string
+	// MAC, Type and Fields are parsed from the USN of a discovery
+	// response. Devices opened by address only have Type, taken from
+	// the root API.
+	MAC net.HardwareAddr
+	Type DeviceType
+	Fields map[string]string
 	Header http.Header
 	client *http.Client
+	timeout time.Duration
+	username string
+	password string
+	forceHTTPS bool
+	fingerprint string
+	trustOnFirstUse bool
+	onFirstUse func(fingerprint string) error
+	clamp bool
+	onClamp func([]Adjustment)
+	verify bool
+	verifyRetries int
+	verifyDelay time.Duration
+	pin string
+	resolve Resolver
+	resolveAfter int
+	onMove func(Move)
+	failures int
+	resolving chan struct{}
+	mu sync.Mutex
+	challenge *authChallenge
+	caps *Capabilities
+	updateMu sync.Mutex
+}
+
+func newDevice(u *url.URL, opts []Option) *Device {
+	dev := &Device{BaseURL: u}
+	for _, opt := range opts {
+		opt(dev)
+	}
+	if dev.forceHTTPS && u.Scheme == "http" {
+		secure := *u
+		secure.Scheme = "https"
+		dev.BaseURL = &secure
+	}
+	var client http.Client
+	if dev.client != nil {
+		client = *dev.client
+	}
+	if dev.timeout > 0 {
+		client.Timeout = dev.timeout
+	}
+	dev.client = &client
+	dev.configureTLS()
+	return dev
 }
 
-func NewDevice(msg []byte) (*Device, error) {
+func NewDevice(msg []byte, opts ...Option) (*Device, error) {
 	br := bufio.NewReader(bytes.NewReader(msg))
 	resp, err := http.ReadResponse(br, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	if resp.Header.Get("ST") != "venstar:thermostat:ecp" {
+	if resp.Header.Get("ST") != SearchTarget {
 		return nil, nil
 	}
-	u, err := url.Parse(resp.Header.Get("Location"))
+	return deviceFromHeader(resp.Header, opts)
+}
+
+// deviceFromHeader builds a device from the Location and USN headers
+// shared by search responses and NOTIFY announcements.
+func deviceFromHeader(h http.Header, opts []Option) (*Device, error) {
+	loc := h.Get("Location")
+	u, err := parseLocation(loc)
+	if err != nil {
+		return nil, &ResponseError{Header: "Location", Value: loc, Reason: "invalid url", Err: err}
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, &ResponseError{Header: "Location", Value: loc, Reason: "expected an http or https url"}
+	}
+	id, err := parseUSN(h.Get("USN"))
 	if err != nil {
 		return nil, err
 	}
-	usn := strings.Split(resp.Header.Get("USN"), ":")
-	var name string
-	for i, part := range usn {
-		if strings.ToLower(part) == "name" && i < len(usn) - 1 {
-			name = usn[i+1]
-			break
-		}
+	dev := newDevice(u, opts)
+	dev.Name = id.name
+	dev.MAC = id.mac
+	dev.Type = id.typ
+	dev.Fields = id.fields
+	dev.Header = h
+	return dev, nil
+}
+
+// parseLocation parses a Location header, escaping the zone of an IPv6
+// literal such as http://[fe80::1%eth0]/ that devices send unescaped.
+func parseLocation(loc string) (*url.URL, error) {
+	u, err := url.Parse(loc)
+	if err == nil {
+		return u, nil
+	}
+	start := strings.Index(loc, "[")
+	end := strings.Index(loc, "]")
+	if start < 0 || end < start {
+		return nil, err
+	}
+	host := loc[start:end]
+	if i := strings.Index(host, "%"); i >= 0 && !strings.HasPrefix(host[i:], "%25") {
+		host = host[:i] + "%25" + host[i+1:]
+	}
+	return url.Parse(loc[:start] + host + loc[end:])
+}
+
+func Open(addr string, opts ...Option) (*Device, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return OpenContext(ctx, addr, opts...)
+}
+
+func OpenContext(ctx context.Context, addr string, opts ...Option) (*Device, error) {
+	u, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	dev := newDevice(u, opts)
+	caps, err := dev.CapabilitiesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error probing %s: %w", u, err)
+	}
+	dev.Type = caps.Type
+	info, err := dev.InfoContext(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return &Device{
-		BaseURL: u,
-		Name: name,
-		Header: resp.Header,
-		client: &http.Client{},
-	}, nil
+	dev.Name = info.Name
+	return dev, nil
 }
 
 func (dev *Device) String() string {
-	return fmt.Sprintf("%s: %s", dev.Name, dev.BaseURL.String())
+	return fmt.Sprintf("%s: %s", dev.Name, dev.URL().String())
 }
 
-func (dev *Device) get(path []string, obj any) error {
-	res, err := dev.client.Get(dev.BaseURL.JoinPath(path...).String())
+// URL returns the device's current base URL. It is safe to call while
+// the device is in use, unlike reading BaseURL directly.
+func (dev *Device) URL() *url.URL {
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	return dev.BaseURL
+}
+
+// SetPIN sets the screen lock PIN sent with every control and settings
+// write. An empty PIN disables sending it.
+func (dev *Device) SetPIN(pin string) {
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	dev.pin = pin
+}
+
+func (dev *Device) PIN() string {
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	return dev.pin
+}
+
+func (dev *Device) url(path ...string) string {
+	return dev.URL().JoinPath(path...).String()
+}
+
+func (dev *Device) do(req *http.Request) (*http.Response, error) {
+	res, err := dev.send(req)
+	if dev.resolve == nil {
+		return res, err
+	}
+	return dev.heal(req, res, err)
+}
+
+func (dev *Device) send(req *http.Request) (*http.Response, error) {
+	dev.authorize(req)
+	res, err := dev.client.Do(req)
+	if err != nil {
+		retry := isRefused(err) || (req.Method == http.MethodGet && isDropped(err))
+		if req.URL.Scheme == "http" && req.Context().Err() == nil && retry {
+			if secure, uerr := dev.upgrade(req); uerr == nil {
+				return secure, nil
+			}
+		}
+		return nil, err
+	}
+	if req.URL.Scheme == "http" && wantsHTTPS(res) {
+		if secure, uerr := dev.upgrade(req); uerr == nil {
+			return secure, nil
+		}
+		return res, nil
+	}
+	if res.StatusCode != http.StatusUnauthorized || (dev.username == "" && dev.password == "") {
+		return res, nil
+	}
+	bufferBody(res)
+	if !dev.setChallenge(res.Header.Values("WWW-Authenticate")) {
+		return res, nil
+	}
+	retry, err := cloneRequest(req, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	dev.authorize(retry)
+	return dev.client.Do(retry)
+}
+
+// upgrade retries a plain http request over https, for devices whose
+// SSDP Location still advertises http after HTTPS was enabled. The
+// device's port either refuses plain http or answers it with an error.
+func (dev *Device) upgrade(req *http.Request) (*http.Response, error) {
+	secure := *req.URL
+	secure.Scheme = "https"
+	retry, err := cloneRequest(req, &secure)
+	if err != nil {
+		return nil, err
+	}
+	res, err := dev.send(retry)
+	if err != nil {
+		return nil, err
+	}
+	dev.mu.Lock()
+	if dev.BaseURL.Scheme == "http" {
+		base := *dev.BaseURL
+		base.Scheme = "https"
+		dev.BaseURL = &base
+	}
+	dev.mu.Unlock()
+	return res, nil
+}
+
+func (dev *Device) get(ctx context.Context, path []string, obj any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, dev.url(path...), nil)
 	if err != nil {
 		return err
 	}
+	res, err := dev.do(req)
+	if err != nil {
+		return transportError(req, err)
+	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return errors.New(res.Status)
+		return newHTTPError(req, res)
 	}
 	dec := json.NewDecoder(res.Body)
-	return dec.Decode(obj)
+	err = dec.Decode(obj)
+	if err != nil {
+		return &DecodeError{Method: req.Method, URL: req.URL.String(), Err: err}
+	}
+	return nil
 }
 
-func (dev *Device) post(path []string, obj any) error {
-	rv := reflect.ValueOf(obj)
-	rt := rv.Type()
-	vals := url.Values{}
-	for rt.Kind() == reflect.Ptr {
-		if rv.IsNil() {
-			return errors.New("nil input")
-		}
-		rv = rv.Elem()
-		rt = rt.Elem()
-	}
-	if rt.Kind() != reflect.Struct {
-		return errors.New("input is not a struct")
+func (dev *Device) post(ctx context.Context, path []string, obj any) error {
+	u := dev.url(path...)
+	vals, err := EncodeForm(obj)
+	if err != nil {
+		return &EncodeError{URL: u, Err: err}
 	}
-	for i := 0; i < rt.NumField(); i++ {
-		sf := rt.Field(i)
-		if sf.PkgPath != "" {
-			continue
-		}
-		var name string
-		var omitempty bool
-		tag := sf.Tag.Get("json")
-		if tag == "" {
-			name = toSnakeCase(sf.Name)
-		} else {
-			parts := strings.Split(sf.Tag.Get("json"), ",")
-			name = parts[0]
-			if name == "-" {
-				continue
-			}
-			if len(parts) > 1 {
-				for _, part := range parts[1:] {
-					if part == "omitempty" {
-						omitempty = true
-					}
-				}
-			}
-		}
-		switch sf.Type.Kind() {
-		case reflect.String:
-			s := rv.Field(i).String()
-			if omitempty && s == "" {
-				continue
-			}
-			vals.Add(name, s)
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			iv := rv.Field(i).Int()
-			if omitempty && iv == 0 {
-				continue
-			}
-			vals.Add(name, strconv.FormatInt(iv, 10))
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			uv := rv.Field(i).Uint()
-			if omitempty && uv == 0 {
-				continue
-			}
-			vals.Add(name, strconv.FormatUint(uv, 10))
-		case reflect.Float64, reflect.Float32:
-			fv := rv.Field(i).Float()
-			if omitempty && fv == 0 {
-				continue
-			}
-			vals.Add(name, strconv.FormatFloat(fv, 'f', -1, 64))
-		case reflect.Bool:
-			bv := rv.Field(i).Bool()
-			if omitempty && !bv {
-				continue
-			}
-			vals.Add(name, strconv.FormatBool(bv))
-		default:
-			return fmt.Errorf("unsupported field %s type %T", sf.Name, rv.Field(i).Interface())
-		}
+	if pin := dev.PIN(); pin != "" {
+		vals.Set("pin", pin)
 	}
-	res, err := dev.client.PostForm(dev.BaseURL.JoinPath(path...).String(), vals)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(vals.Encode()))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := dev.do(req)
+	if err != nil {
+		return transportError(req, err)
+	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return errors.New(res.Status)
+		return newHTTPError(req, res)
 	}
 	var status StatusResponse
 	dec := json.NewDecoder(res.Body)
 	err = dec.Decode(&status)
 	if err != nil {
-		return err
+		return &DecodeError{Method: req.Method, URL: req.URL.String(), Err: err}
 	}
 	if status.Error {
-		return errors.New(status.Reason)
+		devErr := DeviceError{Path: req.URL.Path, Reason: status.Reason}
+		if isPINReason(status.Reason) {
+			return &PINError{DeviceError: devErr, Provided: vals.Get("pin") != ""}
+		}
+		return &devErr
 	}
 	return nil
 }
 
 func (dev *Device) Info() (*DeviceInfo, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.InfoContext(ctx)
+}
+
+func (dev *Device) InfoContext(ctx context.Context) (*DeviceInfo, error) {
 	info := &DeviceInfo{}
-	err := dev.get([]string{"query", "info"}, info)
+	err := dev.get(ctx, []string{"query", "info"}, info)
 	if err != nil {
 		return nil, err
 	}
@@ -170,8 +333,14 @@ func (dev *Device) Info() (*DeviceInfo, error) {
 }
 
 func (dev *Device) Sensors() (map[string]*SensorInfo, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SensorsContext(ctx)
+}
+
+func (dev *Device) SensorsContext(ctx context.Context) (map[string]*SensorInfo, error) {
 	var resp SensorsResponse
-	err := dev.get([]string{"query", "sensors"}, &resp)
+	err := dev.get(ctx, []string{"query", "sensors"}, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -183,8 +352,14 @@ func (dev *Device) Sensors() (map[string]*SensorInfo, error) {
 }
 
 func (dev *Device) Alerts() (map[string]*AlertInfo, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.AlertsContext(ctx)
+}
+
+func (dev *Device) AlertsContext(ctx context.Context) (map[string]*AlertInfo, error) {
 	var resp AlertsResponse
-	err := dev.get([]string{"query", "alerts"}, &resp)
+	err := dev.get(ctx, []string{"query", "alerts"}, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -196,139 +371,222 @@ func (dev *Device) Alerts() (map[string]*AlertInfo, error) {
 }
 
 func (dev *Device) Runtimes() ([]*RuntimeInfo, error) {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.RuntimesContext(ctx)
+}
+
+func (dev *Device) RuntimesContext(ctx context.Context) ([]*RuntimeInfo, error) {
 	var resp RuntimesResponse
-	err := dev.get([]string{"query", "runtimes"}, &resp)
+	err := dev.get(ctx, []string{"query", "runtimes"}, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return resp.Runtimes, nil
 }
 
-func (dev *Device) SetMode(mode ThermostatMode) error {
-	info, err := dev.Info()
+func (dev *Device) Update(fn func(c *ControlMessage, s *SettingsMessage) error) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.UpdateContext(ctx, fn)
+}
+
+// UpdateContext reads the current state once, lets fn modify the control
+// and settings messages built from it, and then sends at most one control
+// and one settings write for whichever of them fn changed. Concurrent
+// updates on the same Device are serialized.
+func (dev *Device) UpdateContext(ctx context.Context, fn func(c *ControlMessage, s *SettingsMessage) error) error {
+	dev.updateMu.Lock()
+	defer dev.updateMu.Unlock()
+	info, err := dev.InfoContext(ctx)
 	if err != nil {
 		return fmt.Errorf("error getting current settings: %w", err)
 	}
-	msg := info.ControlMessage().WithMode(mode)
-	err = msg.Validate()
+	control := info.ControlMessage()
+	settings := info.SettingsMessage()
+	err = fn(&control, &settings)
 	if err != nil {
 		return err
 	}
-	return dev.post([]string{"control"}, msg)
+	var writes []pendingWrite
+	if !reflect.DeepEqual(control, info.ControlMessage()) {
+		control, err = dev.checkControl(info, control)
+		if err != nil {
+			return err
+		}
+		writes = append(writes, pendingWrite{path: "control", msg: control, check: control.mismatches})
+	}
+	if !reflect.DeepEqual(settings, info.SettingsMessage()) {
+		// only changed settings are sent, so untouched fields a model
+		// does not support are never written
+		w, err := dev.settingsWrite(ctx, settingsDiff(info.SettingsMessage(), settings))
+		if err != nil {
+			return err
+		}
+		writes = append(writes, w)
+	}
+	return dev.write(ctx, writes...)
+}
+
+func (dev *Device) SetMode(mode ThermostatMode) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetModeContext(ctx, mode)
+}
+
+func (dev *Device) SetModeContext(ctx context.Context, mode ThermostatMode) error {
+	return dev.UpdateContext(ctx, func(c *ControlMessage, s *SettingsMessage) error {
+		*c = c.WithMode(mode)
+		return nil
+	})
 }
 
 func (dev *Device) SetFanMode(mode FanSetting) error {
-	info, err := dev.Info()
-	if err != nil {
-		return fmt.Errorf("error getting current settings: %w", err)
-	}
-	msg := info.ControlMessage().WithFan(mode)
-	err = msg.Validate()
-	if err != nil {
-		return err
-	}
-	return dev.post([]string{"control"}, msg)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetFanModeContext(ctx, mode)
+}
+
+func (dev *Device) SetFanModeContext(ctx context.Context, mode FanSetting) error {
+	return dev.UpdateContext(ctx, func(c *ControlMessage, s *SettingsMessage) error {
+		*c = c.WithFan(mode)
+		return nil
+	})
 }
 
 func (dev *Device) SetHeatTemp(temp float64) error {
-	info, err := dev.Info()
-	if err != nil {
-		return fmt.Errorf("error getting current settings: %w", err)
-	}
-	mode := info.Mode
-	switch mode {
-	case ModeAuto, ModeHeat:
-	default:
-		mode = ModeHeat
-	}
-	msg := info.ControlMessage().WithMode(mode).WithHeatTemp(temp)
-	err = msg.Validate()
-	if err != nil {
-		return err
-	}
-	return dev.post([]string{"control"}, msg)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetHeatTempContext(ctx, temp)
+}
+
+func (dev *Device) SetHeatTempContext(ctx context.Context, temp float64) error {
+	return dev.UpdateContext(ctx, func(c *ControlMessage, s *SettingsMessage) error {
+		*c = c.withHeatSetpoint(temp)
+		return nil
+	})
 }
 
 func (dev *Device) SetCoolTemp(temp float64) error {
-	info, err := dev.Info()
-	if err != nil {
-		return fmt.Errorf("error getting current settings: %w", err)
-	}
-	mode := info.Mode
-	switch mode {
-	case ModeAuto, ModeCool:
-	default:
-		mode = ModeCool
-	}
-	msg := info.ControlMessage().WithMode(mode).WithCoolTemp(temp)
-	err = msg.Validate()
-	if err != nil {
-		return err
-	}
-	return dev.post([]string{"control"}, msg)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetCoolTempContext(ctx, temp)
+}
+
+func (dev *Device) SetCoolTempContext(ctx context.Context, temp float64) error {
+	return dev.UpdateContext(ctx, func(c *ControlMessage, s *SettingsMessage) error {
+		*c = c.withCoolSetpoint(temp)
+		return nil
+	})
 }
 
 func (dev *Device) SetHeatCoolTemps(heat, cool float64) error {
-	if heat > cool {
-		heat, cool = cool, heat
-	}
-	info, err := dev.Info()
-	if err != nil {
-		return fmt.Errorf("error getting current settings: %w", err)
-	}
-	msg := info.ControlMessage().WithMode(ModeAuto).WithHeatTemp(heat).WithCoolTemp(cool)
-	err = msg.Validate()
-	if err != nil {
-		return err
-	}
-	return dev.post([]string{"control"}, msg)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetHeatCoolTempsContext(ctx, heat, cool)
+}
+
+func (dev *Device) SetHeatCoolTempsContext(ctx context.Context, heat, cool float64) error {
+	return dev.UpdateContext(ctx, func(c *ControlMessage, s *SettingsMessage) error {
+		*c = c.withHeatCoolSetpoints(heat, cool)
+		return nil
+	})
 }
 
 func (dev *Device) SetTempUnits(units TempUnits) error {
-	info, err := dev.Info()
-	if err != nil {
-		return fmt.Errorf("error getting current settings: %w", err)
-	}
-	msg := info.SettingsMessage().WithTempUnits(units)
-	return dev.post([]string{"settings"}, msg)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetTempUnitsContext(ctx, units)
+}
+
+func (dev *Device) SetTempUnitsContext(ctx context.Context, units TempUnits) error {
+	return dev.PatchSettingsContext(ctx, SettingsUpdate{}.WithTempUnits(units))
 }
 
-/*
 func (dev *Device) SetAway(away AwayState) error {
-	info, err := dev.Info()
-	if err != nil {
-		return fmt.Errorf("error getting current settings: %w", err)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetAwayContext(ctx, away)
+}
+
+func (dev *Device) SetAwayContext(ctx context.Context, away AwayState) error {
+	return dev.PatchSettingsContext(ctx, SettingsUpdate{}.WithAway(away))
+}
+
+func (dev *Device) SetHoliday(holiday HolidayState) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetHolidayContext(ctx, holiday)
+}
+
+func (dev *Device) SetHolidayContext(ctx context.Context, holiday HolidayState) error {
+	return dev.PatchSettingsContext(ctx, SettingsUpdate{}.WithHoliday(holiday))
+}
+
+func (dev *Device) StartOverride(duration time.Duration) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.StartOverrideContext(ctx, duration)
+}
+
+// StartOverrideContext puts a commercial thermostat in occupied override
+// for duration, rounded up to whole minutes.
+func (dev *Device) StartOverrideContext(ctx context.Context, duration time.Duration) error {
+	minutes := int((duration + time.Minute - 1) / time.Minute)
+	if minutes <= 0 {
+		return &ValidationError{Field: "overridetime", Value: duration.Minutes(), Min: 1, Max: math.NaN()}
 	}
-	msg := info.SettingsMessage().WithAway(away)
-	return dev.post([]string{"settings"}, msg)
+	return dev.PatchSettingsContext(ctx, SettingsUpdate{}.WithOverride(OverrideStateOn, minutes))
+}
+
+func (dev *Device) CancelOverride() error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.CancelOverrideContext(ctx)
+}
+
+func (dev *Device) CancelOverrideContext(ctx context.Context) error {
+	return dev.PatchSettingsContext(ctx, SettingsUpdate{}.WithOverride(OverrideStateOff, 0))
+}
+
+func (dev *Device) SetForceUnoccupied(state ForceUnoccState) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetForceUnoccupiedContext(ctx, state)
+}
+
+func (dev *Device) SetForceUnoccupiedContext(ctx context.Context, state ForceUnoccState) error {
+	return dev.PatchSettingsContext(ctx, SettingsUpdate{}.WithForceUnocc(state))
 }
-*/
 
 func (dev *Device) SetSchedule(sched ScheduleState) error {
-	info, err := dev.Info()
-	if err != nil {
-		return fmt.Errorf("error getting current settings: %w", err)
-	}
-	msg := info.SettingsMessage().WithSchedule(sched)
-	return dev.post([]string{"settings"}, msg)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetScheduleContext(ctx, sched)
+}
+
+func (dev *Device) SetScheduleContext(ctx context.Context, sched ScheduleState) error {
+	return dev.PatchSettingsContext(ctx, SettingsUpdate{}.WithSchedule(sched))
 }
 
 func (dev *Device) SetHumidifySetpoint(setpoint float64) error {
-	info, err := dev.Info()
-	if err != nil {
-		return fmt.Errorf("error getting current settings: %w", err)
-	}
-	msg := info.SettingsMessage().WithHumidifySetpoint(setpoint)
-	return dev.post([]string{"settings"}, msg)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetHumidifySetpointContext(ctx, setpoint)
+}
+
+func (dev *Device) SetHumidifySetpointContext(ctx context.Context, setpoint float64) error {
+	return dev.PatchSettingsContext(ctx, SettingsUpdate{}.WithHumidifySetpoint(setpoint))
 }
 
 func (dev *Device) SetDehumidifySetpoint(setpoint float64) error {
-	info, err := dev.Info()
-	if err != nil {
-		return fmt.Errorf("error getting current settings: %w", err)
-	}
-	msg := info.SettingsMessage().WithDehumidifySetpoint(setpoint)
-	return dev.post([]string{"settings"}, msg)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetDehumidifySetpointContext(ctx, setpoint)
+}
+
+func (dev *Device) SetDehumidifySetpointContext(ctx context.Context, setpoint float64) error {
+	return dev.PatchSettingsContext(ctx, SettingsUpdate{}.WithDehumidifySetpoint(setpoint))
 }
 
 type ThermostatMode int
@@ -630,32 +888,40 @@ type DeviceInfo struct {
 	CoolTempMin        float64         `json:"cooltempmin"`
 	CoolTempMax        float64         `json:"cooltempmax"`
 	HeatTempMin        float64         `json:"heattempmin"`
-	HeatTempMax        float64         `json:"heattempmin"`
+	HeatTempMax        float64         `json:"heattempmax"`
 	SetPointDelta      float64         `json:"setpointdelta"`
 	Humidity           float64         `json:"hum"`
 	HumidifySetpoint   float64         `json:"hum_setpoint"`
 	DehumidifySetpoint float64         `json:"dehum_setpoint"`
 	Humidifier         HumidifierState `json:"hum_active"`
 	AvailableModes     AvailableModes  `json:"availablemodes"`
+	// Extra holds fields reported by the firmware that DeviceInfo has no
+	// field for.
+	Extra              map[string]json.RawMessage `json:"-"`
+	raw                json.RawMessage
 //{"name":"THERMOSTAT","mode":3,"state":1,"activestage":1,"fan":0,"fanstate":0,"tempunits":0,"schedule":0,"schedulepart":0,"holiday":0,"override":0,"overridetime":0,"forceunocc":0,"spacetemp":71.0,"heattemp":73.0,"cooltemp":81.0,"cooltempmin":35.0,"cooltempmax":99.0,"heattempmin":35.0,"heattempmax":99.0,"setpointdelta":2,"availablemodes":0}
 }
 
-func (info *DeviceInfo) ControlMessage() ControlMessage {
+// ControlMessage builds a control message from the current state. Any
+// passthrough keys present in Extra are copied into the message so that
+// device specific fields are written back unchanged.
+func (info *DeviceInfo) ControlMessage(passthrough ...string) ControlMessage {
 	return ControlMessage{
 		Mode:     info.Mode,
 		Fan:      info.FanSetting,
 		HeatTemp: info.HeatTemp,
 		CoolTemp: info.CoolTemp,
+		Extra:    info.extraValues(passthrough),
 	}
 }
 
-func (info *DeviceInfo) SettingsMessage() SettingsMessage {
+func (info *DeviceInfo) SettingsMessage(passthrough ...string) SettingsMessage {
 	return SettingsMessage{
 		TempUnits:          info.TempUnits,
-		//Away:               info.Away,
 		Schedule:           info.Schedule,
 		HumidifySetpoint:   info.HumidifySetpoint,
 		DehumidifySetpoint: info.DehumidifySetpoint,
+		Extra:              info.extraValues(passthrough),
 	}
 }
 
@@ -676,6 +942,8 @@ type SensorInfo struct {
 	CO2PPM           float64    `json:"co2"`
 	Battery          float64    `json:"battery"`
 	Type             SensorType `json:"type"`
+	Extra            map[string]json.RawMessage `json:"-"`
+	raw              json.RawMessage
 }
 
 type SensorsResponse struct {
@@ -697,6 +965,7 @@ type RuntimeInfo struct {
 	Override        float64 `json:"ov"`
 	FilterHours     float64 `json:"filterHours"`
 	FilterDays      float64 `json:"filterDays"`
+	Extra           map[string]json.RawMessage `json:"-"`
 }
 
 type RuntimesResponse struct {
@@ -707,6 +976,7 @@ type RuntimesResponse struct {
 type AlertInfo struct {
 	Name   string `json:"name"`
 	Active bool   `json:"active"`
+	Extra  map[string]json.RawMessage `json:"-"`
 }
 
 type AlertsResponse struct {
@@ -719,6 +989,14 @@ type ControlMessage struct {
 	Fan      FanSetting     `json:"fan"`
 	HeatTemp float64        `json:"heattemp"`
 	CoolTemp float64        `json:"cooltemp"`
+	// Extra holds additional form fields to send, for settings newer
+	// firmware supports that have no field here.
+	Extra    url.Values     `json:"-"`
+}
+
+func (msg ControlMessage) WithField(name, value string) ControlMessage {
+	msg.Extra = withField(msg.Extra, name, value)
+	return msg
 }
 
 func (msg ControlMessage) WithMode(mode ThermostatMode) ControlMessage {
@@ -741,19 +1019,71 @@ func (msg ControlMessage) WithCoolTemp(temp float64) ControlMessage {
 	return msg
 }
 
+// withHeatSetpoint sets the heat setpoint, switching to heat mode unless
+// the message is already in heat or auto mode.
+func (msg ControlMessage) withHeatSetpoint(temp float64) ControlMessage {
+	mode := msg.Mode
+	switch mode {
+	case ModeAuto, ModeHeat:
+	default:
+		mode = ModeHeat
+	}
+	return msg.WithMode(mode).WithHeatTemp(temp)
+}
+
+func (msg ControlMessage) withCoolSetpoint(temp float64) ControlMessage {
+	mode := msg.Mode
+	switch mode {
+	case ModeAuto, ModeCool:
+	default:
+		mode = ModeCool
+	}
+	return msg.WithMode(mode).WithCoolTemp(temp)
+}
+
+func (msg ControlMessage) withHeatCoolSetpoints(heat, cool float64) ControlMessage {
+	if heat > cool {
+		heat, cool = cool, heat
+	}
+	return msg.WithMode(ModeAuto).WithHeatTemp(heat).WithCoolTemp(cool)
+}
+
+// Validate checks for the 2 degree gap between setpoints that Fahrenheit
+// units use by default.
+//
+// Deprecated: use ValidateFor, which honours the device's setpoint limits
+// and delta.
 func (msg ControlMessage) Validate() error {
 	if msg.CoolTemp - msg.HeatTemp < 2 {
-		return fmt.Errorf("difference between heat & cool temps (%f) less than 2 degrees", msg.CoolTemp - msg.HeatTemp)
+		return &ValidationError{
+			Field: "cooltemp",
+			Value: msg.CoolTemp,
+			Min: msg.HeatTemp + 2,
+			Max: math.NaN(),
+			Reason: fmt.Sprintf("difference between heat & cool temps (%f) less than 2 degrees", msg.CoolTemp - msg.HeatTemp),
+		}
 	}
 	return nil
 }
 
 type SettingsMessage struct {
 	TempUnits          TempUnits     `json:"tempunits"`
-	//Away               AwayState     `json:"away"`
 	Schedule           ScheduleState `json:"schedule"`
 	HumidifySetpoint   float64       `json:"hum_setpoint"`
 	DehumidifySetpoint float64       `json:"dehum_setpoint"`
+	// Residential only; nil leaves the current state unchanged.
+	Away *AwayState `json:"away,omitempty"`
+	// Commercial only; nil leaves the current state unchanged.
+	Holiday      *HolidayState    `json:"holiday,omitempty"`
+	Override     *OverrideState   `json:"override,omitempty"`
+	OverrideTime *int             `json:"overridetime,omitempty"`
+	ForceUnocc   *ForceUnoccState `json:"forceunocc,omitempty"`
+	Extra        url.Values       `json:"-"`
+}
+
+func (msg SettingsMessage) WithField(name, value string) SettingsMessage {
+	msg.Extra = withField(msg.Extra, name, value)
+	return msg
 }
 
 func (msg SettingsMessage) WithTempUnits(units TempUnits) SettingsMessage {
@@ -761,12 +1091,28 @@ func (msg SettingsMessage) WithTempUnits(units TempUnits) SettingsMessage {
 	return msg
 }
 
-/*
 func (msg SettingsMessage) WithAway(away AwayState) SettingsMessage {
-	msg.Away = away
+	msg.Away = &away
+	return msg
+}
+
+func (msg SettingsMessage) WithHoliday(holiday HolidayState) SettingsMessage {
+	msg.Holiday = &holiday
+	return msg
+}
+
+// WithOverride sets the commercial occupancy override state and the
+// override duration in minutes.
+func (msg SettingsMessage) WithOverride(override OverrideState, minutes int) SettingsMessage {
+	msg.Override = &override
+	msg.OverrideTime = &minutes
+	return msg
+}
+
+func (msg SettingsMessage) WithForceUnocc(state ForceUnoccState) SettingsMessage {
+	msg.ForceUnocc = &state
 	return msg
 }
-*/
 
 func (msg SettingsMessage) WithSchedule(sched ScheduleState) SettingsMessage {
 	msg.Schedule = sched
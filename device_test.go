@@ -0,0 +1,68 @@
+package venstar_test
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestUpdateSendsOnlyChangedSettings(t *testing.T) {
+	// Explorer models have no humidity control
+	srv := venstartest.NewServer(venstartest.WithModel("EXPLORER"), venstartest.WithPIN("1234"))
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL, venstar.WithPIN("1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := srv.Info()
+	err = dev.Update(func(c *venstar.ControlMessage, s *venstar.SettingsMessage) error {
+		c.Fan = venstar.FanSettingOn
+		s.Schedule = 1 - s.Schedule
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := srv.Info()
+	if after.FanSetting != venstar.FanSettingOn || after.Schedule == before.Schedule {
+		t.Errorf("update not applied: fan %v, schedule %v", after.FanSetting, after.Schedule)
+	}
+	forms := srv.Forms("/settings")
+	if len(forms) != 1 {
+		t.Fatalf("%d settings writes, want 1", len(forms))
+	}
+	want := url.Values{
+		"schedule": {strconv.Itoa(int(after.Schedule))},
+		"pin":      {"1234"},
+	}
+	if !reflect.DeepEqual(forms[0], want) {
+		t.Errorf("settings form = %v, want %v", forms[0], want)
+	}
+	err = dev.SetDehumidifySetpoint(50)
+	if !errors.Is(err, venstar.ErrUnsupported) {
+		t.Errorf("SetDehumidifySetpoint = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestUpdateWithoutChanges(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dev.Update(func(c *venstar.ControlMessage, s *venstar.SettingsMessage) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Forms("/control")) + len(srv.Forms("/settings")); n != 0 {
+		t.Errorf("%d writes for an update that changed nothing", n)
+	}
+}
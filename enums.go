@@ -0,0 +1,376 @@
+package venstar
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseEnum looks s up case insensitively among names and aliases, and
+// falls back to accepting the numeric form of a known value.
+func parseEnum[T ~int](s string, names map[T]string, aliases map[string]T, typeName string) (T, error) {
+	s = strings.TrimSpace(s)
+	for v, name := range names {
+		if strings.EqualFold(name, s) {
+			return v, nil
+		}
+	}
+	if v, ok := aliases[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", typeName, s)
+	}
+	if _, ok := names[T(n)]; !ok {
+		return 0, fmt.Errorf("unknown %s %d", typeName, n)
+	}
+	return T(n), nil
+}
+
+func marshalEnum[T ~int](v T, names map[T]string) ([]byte, error) {
+	s, ok := names[v]
+	if !ok {
+		s = strconv.Itoa(int(v))
+	}
+	return []byte(s), nil
+}
+
+// unmarshalEnumJSON accepts both the integers the device sends and the
+// names MarshalText produces. Unlike parsing, any integer is accepted so
+// values added by newer firmware still decode. Like the standard library,
+// null leaves v unchanged.
+func unmarshalEnumJSON[T ~int](data []byte, v *T, parse func(string) (T, error)) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if len(data) > 0 && data[0] == '"' {
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			return err
+		}
+	} else {
+		var n json.Number
+		err := json.Unmarshal(data, &n)
+		if err != nil {
+			return err
+		}
+		s = n.String()
+		if f, err := n.Float64(); err == nil && f == float64(int(f)) {
+			s = strconv.Itoa(int(f))
+		}
+	}
+	x, err := parse(s)
+	if err != nil {
+		n, nerr := strconv.Atoi(s)
+		if nerr != nil {
+			return err
+		}
+		x = T(n)
+	}
+	*v = x
+	return nil
+}
+
+var tempUnitsAliases = map[string]TempUnits{
+	"f":          Fahrenheit,
+	"fahrenheit": Fahrenheit,
+	"c":          Celsius,
+	"celsius":    Celsius,
+}
+
+func ParseThermostatMode(s string) (ThermostatMode, error) {
+	return parseEnum(s, thermostatModeNames, nil, "thermostat mode")
+}
+
+func (mode ThermostatMode) MarshalText() ([]byte, error) {
+	return marshalEnum(mode, thermostatModeNames)
+}
+
+func (mode *ThermostatMode) UnmarshalText(data []byte) error {
+	v, err := ParseThermostatMode(string(data))
+	if err != nil {
+		return err
+	}
+	*mode = v
+	return nil
+}
+
+func (mode *ThermostatMode) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, mode, ParseThermostatMode)
+}
+
+func ParseThermostatState(s string) (ThermostatState, error) {
+	return parseEnum(s, thermostatStateNames, nil, "thermostat state")
+}
+
+func (state ThermostatState) MarshalText() ([]byte, error) {
+	return marshalEnum(state, thermostatStateNames)
+}
+
+func (state *ThermostatState) UnmarshalText(data []byte) error {
+	v, err := ParseThermostatState(string(data))
+	if err != nil {
+		return err
+	}
+	*state = v
+	return nil
+}
+
+func (state *ThermostatState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, state, ParseThermostatState)
+}
+
+func ParseDemandStage(s string) (DemandStage, error) {
+	return parseEnum(s, demandStageNames, nil, "demand stage")
+}
+
+func (stage DemandStage) MarshalText() ([]byte, error) {
+	return marshalEnum(stage, demandStageNames)
+}
+
+func (stage *DemandStage) UnmarshalText(data []byte) error {
+	v, err := ParseDemandStage(string(data))
+	if err != nil {
+		return err
+	}
+	*stage = v
+	return nil
+}
+
+func (stage *DemandStage) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, stage, ParseDemandStage)
+}
+
+func ParseFanSetting(s string) (FanSetting, error) {
+	return parseEnum(s, fanSettingNames, nil, "fan setting")
+}
+
+func (fan FanSetting) MarshalText() ([]byte, error) {
+	return marshalEnum(fan, fanSettingNames)
+}
+
+func (fan *FanSetting) UnmarshalText(data []byte) error {
+	v, err := ParseFanSetting(string(data))
+	if err != nil {
+		return err
+	}
+	*fan = v
+	return nil
+}
+
+func (fan *FanSetting) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, fan, ParseFanSetting)
+}
+
+func ParseFanState(s string) (FanState, error) {
+	return parseEnum(s, fanStateNames, nil, "fan state")
+}
+
+func (fan FanState) MarshalText() ([]byte, error) {
+	return marshalEnum(fan, fanStateNames)
+}
+
+func (fan *FanState) UnmarshalText(data []byte) error {
+	v, err := ParseFanState(string(data))
+	if err != nil {
+		return err
+	}
+	*fan = v
+	return nil
+}
+
+func (fan *FanState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, fan, ParseFanState)
+}
+
+func ParseTempUnits(s string) (TempUnits, error) {
+	return parseEnum(s, tempUnitsNames, tempUnitsAliases, "temp units")
+}
+
+func (units TempUnits) MarshalText() ([]byte, error) {
+	return marshalEnum(units, tempUnitsNames)
+}
+
+func (units *TempUnits) UnmarshalText(data []byte) error {
+	v, err := ParseTempUnits(string(data))
+	if err != nil {
+		return err
+	}
+	*units = v
+	return nil
+}
+
+func (units *TempUnits) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, units, ParseTempUnits)
+}
+
+func ParseScheduleState(s string) (ScheduleState, error) {
+	return parseEnum(s, scheduleStateNames, nil, "schedule state")
+}
+
+func (state ScheduleState) MarshalText() ([]byte, error) {
+	return marshalEnum(state, scheduleStateNames)
+}
+
+func (state *ScheduleState) UnmarshalText(data []byte) error {
+	v, err := ParseScheduleState(string(data))
+	if err != nil {
+		return err
+	}
+	*state = v
+	return nil
+}
+
+func (state *ScheduleState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, state, ParseScheduleState)
+}
+
+func ParseSchedulePart(s string) (SchedulePart, error) {
+	return parseEnum(s, schedulePartNames, nil, "schedule part")
+}
+
+func (part SchedulePart) MarshalText() ([]byte, error) {
+	return marshalEnum(part, schedulePartNames)
+}
+
+func (part *SchedulePart) UnmarshalText(data []byte) error {
+	v, err := ParseSchedulePart(string(data))
+	if err != nil {
+		return err
+	}
+	*part = v
+	return nil
+}
+
+func (part *SchedulePart) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, part, ParseSchedulePart)
+}
+
+func ParseAwayState(s string) (AwayState, error) {
+	return parseEnum(s, awayStateNames, nil, "away state")
+}
+
+func (state AwayState) MarshalText() ([]byte, error) {
+	return marshalEnum(state, awayStateNames)
+}
+
+func (state *AwayState) UnmarshalText(data []byte) error {
+	v, err := ParseAwayState(string(data))
+	if err != nil {
+		return err
+	}
+	*state = v
+	return nil
+}
+
+func (state *AwayState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, state, ParseAwayState)
+}
+
+func ParseHolidayState(s string) (HolidayState, error) {
+	return parseEnum(s, holidayStateNames, nil, "holiday state")
+}
+
+func (state HolidayState) MarshalText() ([]byte, error) {
+	return marshalEnum(state, holidayStateNames)
+}
+
+func (state *HolidayState) UnmarshalText(data []byte) error {
+	v, err := ParseHolidayState(string(data))
+	if err != nil {
+		return err
+	}
+	*state = v
+	return nil
+}
+
+func (state *HolidayState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, state, ParseHolidayState)
+}
+
+func ParseOverrideState(s string) (OverrideState, error) {
+	return parseEnum(s, overrideStateNames, nil, "override state")
+}
+
+func (state OverrideState) MarshalText() ([]byte, error) {
+	return marshalEnum(state, overrideStateNames)
+}
+
+func (state *OverrideState) UnmarshalText(data []byte) error {
+	v, err := ParseOverrideState(string(data))
+	if err != nil {
+		return err
+	}
+	*state = v
+	return nil
+}
+
+func (state *OverrideState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, state, ParseOverrideState)
+}
+
+func ParseForceUnoccState(s string) (ForceUnoccState, error) {
+	return parseEnum(s, forceUnoccStateNames, nil, "force unocc state")
+}
+
+func (state ForceUnoccState) MarshalText() ([]byte, error) {
+	return marshalEnum(state, forceUnoccStateNames)
+}
+
+func (state *ForceUnoccState) UnmarshalText(data []byte) error {
+	v, err := ParseForceUnoccState(string(data))
+	if err != nil {
+		return err
+	}
+	*state = v
+	return nil
+}
+
+func (state *ForceUnoccState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, state, ParseForceUnoccState)
+}
+
+func ParseHumidifierState(s string) (HumidifierState, error) {
+	return parseEnum(s, humidifierStateNames, nil, "humidifier state")
+}
+
+func (state HumidifierState) MarshalText() ([]byte, error) {
+	return marshalEnum(state, humidifierStateNames)
+}
+
+func (state *HumidifierState) UnmarshalText(data []byte) error {
+	v, err := ParseHumidifierState(string(data))
+	if err != nil {
+		return err
+	}
+	*state = v
+	return nil
+}
+
+func (state *HumidifierState) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, state, ParseHumidifierState)
+}
+
+func ParseAvailableModes(s string) (AvailableModes, error) {
+	return parseEnum(s, availableModesNames, nil, "available modes")
+}
+
+func (mode AvailableModes) MarshalText() ([]byte, error) {
+	return marshalEnum(mode, availableModesNames)
+}
+
+func (mode *AvailableModes) UnmarshalText(data []byte) error {
+	v, err := ParseAvailableModes(string(data))
+	if err != nil {
+		return err
+	}
+	*mode = v
+	return nil
+}
+
+func (mode *AvailableModes) UnmarshalJSON(data []byte) error {
+	return unmarshalEnumJSON(data, mode, ParseAvailableModes)
+}
@@ -0,0 +1,77 @@
+package venstar_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rclancey/venstar"
+)
+
+func TestParseThermostatMode(t *testing.T) {
+	for s, want := range map[string]venstar.ThermostatMode{
+		"heat": venstar.ModeHeat,
+		"COOL": venstar.ModeCool,
+		" 3 ":  venstar.ModeAuto,
+	} {
+		got, err := venstar.ParseThermostatMode(s)
+		if err != nil || got != want {
+			t.Errorf("ParseThermostatMode(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"7", "-1", "warm", ""} {
+		if got, err := venstar.ParseThermostatMode(s); err == nil {
+			t.Errorf("ParseThermostatMode(%q) = %v, want error", s, got)
+		}
+	}
+}
+
+func TestEnumTextRoundTrip(t *testing.T) {
+	var units venstar.TempUnits
+	for _, s := range []string{"f", "Celsius"} {
+		if err := units.UnmarshalText([]byte(s)); err != nil {
+			t.Errorf("UnmarshalText(%q): %v", s, err)
+		}
+	}
+	var fan venstar.FanSetting
+	if err := fan.UnmarshalText([]byte("42")); err == nil {
+		t.Errorf("UnmarshalText(42) = %v, want error", fan)
+	}
+	text, err := venstar.FanSettingOn.MarshalText()
+	if err != nil || string(text) != "on" {
+		t.Errorf("MarshalText = %q, %v; want on", text, err)
+	}
+}
+
+func TestEnumJSONIsLenient(t *testing.T) {
+	// newer firmware may report values this package does not know
+	var info struct {
+		Mode venstar.ThermostatMode `json:"mode"`
+		Fan  venstar.FanSetting     `json:"fan"`
+	}
+	err := json.Unmarshal([]byte(`{"mode": 7, "fan": "on"}`), &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode != venstar.ThermostatMode(7) || info.Fan != venstar.FanSettingOn {
+		t.Errorf("decoded %v/%v", info.Mode, info.Fan)
+	}
+	// null leaves the value unchanged
+	err = json.Unmarshal([]byte(`{"mode": null, "fan": 0}`), &info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode != venstar.ThermostatMode(7) || info.Fan != venstar.FanSettingAuto {
+		t.Errorf("decoded %v/%v after null mode", info.Mode, info.Fan)
+	}
+	if err := json.Unmarshal([]byte(`{"mode": "warm"}`), &info); err == nil {
+		t.Error("decoded unknown mode name")
+	}
+	var dev venstar.DeviceInfo
+	err = json.Unmarshal([]byte(`{"name": "HALL", "mode": null, "fan": 1}`), &dev)
+	if err != nil {
+		t.Fatalf("decoding device info with a null mode: %v", err)
+	}
+	if dev.Name != "HALL" || dev.FanSetting != venstar.FanSettingOn {
+		t.Errorf("decoded name %q, fan %v", dev.Name, dev.FanSetting)
+	}
+}
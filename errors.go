@@ -0,0 +1,248 @@
+package venstar
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const maxErrorBody = 4096
+
+var (
+	ErrUnreachable   = errors.New("device unreachable")
+	ErrNotThermostat = errors.New("not a venstar thermostat")
+	ErrUnsupported   = errors.New("unsupported by device")
+	ErrPINRequired   = errors.New("pin required")
+	ErrPINIncorrect  = errors.New("incorrect pin")
+	ErrNotApplied    = errors.New("write not applied by device")
+	ErrNotFound      = errors.New("thermostat not found")
+)
+
+// UnreachableError wraps a transport failure talking to the device. It
+// matches ErrUnreachable with errors.Is.
+type UnreachableError struct {
+	URL string
+	Err error
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("device at %s unreachable: %s", e.URL, e.Err)
+}
+
+func (e *UnreachableError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UnreachableError) Is(target error) bool {
+	return target == ErrUnreachable
+}
+
+// transportError wraps err in an *UnreachableError unless the caller's
+// context ended or the certificate was refused. A client timeout set
+// with WithTimeout still counts as unreachable.
+func transportError(req *http.Request, err error) error {
+	if req.Context().Err() != nil || isCertificateError(err) {
+		return err
+	}
+	return &UnreachableError{URL: req.URL.String(), Err: err}
+}
+
+func isCertificateError(err error) bool {
+	var certErr *CertificateError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &certErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
+
+// HTTPError is returned when the device answers with a status other than
+// 200 OK.
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func newHTTPError(req *http.Request, res *http.Response) *HTTPError {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	return &HTTPError{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Body:       body,
+	}
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// DecodeError is returned when the body of a 200 OK response from the
+// device cannot be decoded.
+type DecodeError struct {
+	Method string
+	URL    string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s %s: invalid response: %s", e.Method, e.URL, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeError is returned when a message cannot be encoded as a form to
+// post to the device.
+type EncodeError struct {
+	URL string
+	Err error
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("POST %s: invalid message: %s", e.URL, e.Err)
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// ResponseError is returned by NewDevice when a Venstar discovery
+// response is structurally invalid.
+type ResponseError struct {
+	Header string
+	Value  string
+	Reason string
+	Err    error
+}
+
+func (e *ResponseError) Error() string {
+	msg := fmt.Sprintf("invalid venstar response: %s %q: %s", e.Header, e.Value, e.Reason)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+// DeviceError is returned when the device rejects a write with an error
+// StatusResponse.
+type DeviceError struct {
+	Path   string
+	Reason string
+}
+
+func (e *DeviceError) Error() string {
+	return fmt.Sprintf("device rejected %s: %s", e.Path, e.Reason)
+}
+
+// ValidationError is returned when a value is refused before anything is
+// sent to the device. Min or Max is NaN when that side is unbounded.
+type ValidationError struct {
+	Field  string
+	Value  float64
+	Min    float64
+	Max    float64
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+	}
+	switch {
+	case math.IsNaN(e.Min):
+		return fmt.Sprintf("invalid %s %g: above maximum %g", e.Field, e.Value, e.Max)
+	case math.IsNaN(e.Max):
+		return fmt.Sprintf("invalid %s %g: below minimum %g", e.Field, e.Value, e.Min)
+	}
+	return fmt.Sprintf("invalid %s %g: outside range %g to %g", e.Field, e.Value, e.Min, e.Max)
+}
+
+// CertificateError is returned when the device certificate does not
+// match the pinned fingerprint.
+type CertificateError struct {
+	Fingerprint string
+	Pinned      string
+}
+
+func (e *CertificateError) Error() string {
+	return fmt.Sprintf("device certificate fingerprint %s does not match pinned %s", e.Fingerprint, e.Pinned)
+}
+
+// PINError is returned when a locked thermostat rejects a write because
+// the PIN was missing or wrong. It matches ErrPINRequired or
+// ErrPINIncorrect with errors.Is depending on whether a PIN was sent, and
+// unwraps to the underlying DeviceError.
+type PINError struct {
+	DeviceError
+	Provided bool
+}
+
+func (e *PINError) Error() string {
+	if e.Provided {
+		return "device rejected pin: " + e.Reason
+	}
+	return "device requires pin: " + e.Reason
+}
+
+func (e *PINError) Is(target error) bool {
+	if e.Provided {
+		return target == ErrPINIncorrect
+	}
+	return target == ErrPINRequired
+}
+
+func (e *PINError) Unwrap() error {
+	return &e.DeviceError
+}
+
+func isPINReason(reason string) bool {
+	reason = strings.ToLower(reason)
+	return strings.Contains(reason, "pin") || strings.Contains(reason, "locked")
+}
+
+// UnsupportedError is returned instead of sending a request the device
+// would reject or ignore. It matches ErrUnsupported with errors.Is.
+type UnsupportedError struct {
+	Feature      string
+	Capabilities *Capabilities
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s unsupported by %s", e.Feature, e.Capabilities)
+}
+
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+// NotAppliedError is returned by verified writes when the device reported
+// success but its state does not reflect the request. It matches
+// ErrNotApplied with errors.Is.
+type NotAppliedError struct {
+	Mismatches []Mismatch
+}
+
+func (e *NotAppliedError) Error() string {
+	parts := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		parts[i] = m.String()
+	}
+	return "write not applied by device: " + strings.Join(parts, ", ")
+}
+
+func (e *NotAppliedError) Is(target error) bool {
+	return target == ErrNotApplied
+}
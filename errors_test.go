@@ -0,0 +1,91 @@
+package venstar_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestUnreachable(t *testing.T) {
+	srv := venstartest.NewServer()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	_, err = dev.Info()
+	var uerr *venstar.UnreachableError
+	if !errors.Is(err, venstar.ErrUnreachable) || !errors.As(err, &uerr) {
+		t.Fatalf("Info() = %v, want *UnreachableError", err)
+	}
+	if uerr.URL != srv.URL+"/query/info" {
+		t.Errorf("URL = %s, want %s/query/info", uerr.URL, srv.URL)
+	}
+}
+
+func TestHungDeviceUnreachable(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL, venstar.WithTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetLatency(time.Second)
+	_, err = dev.Info()
+	if !errors.Is(err, venstar.ErrUnreachable) {
+		t.Errorf("Info() from hung device = %v, want ErrUnreachable", err)
+	}
+
+	// the caller's own deadline is reported as it is
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = dev.InfoContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, venstar.ErrUnreachable) {
+		t.Errorf("InfoContext past deadline = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetHTTPError("/query/sensors", http.StatusServiceUnavailable)
+	_, err = dev.Sensors()
+	var herr *venstar.HTTPError
+	if !errors.As(err, &herr) {
+		t.Fatalf("Sensors() = %v, want *HTTPError", err)
+	}
+	if herr.StatusCode != http.StatusServiceUnavailable || herr.Method != http.MethodGet {
+		t.Errorf("got %s %d, want GET 503", herr.Method, herr.StatusCode)
+	}
+	if !strings.Contains(string(herr.Body), "Service Unavailable") {
+		t.Errorf("Body = %q", herr.Body)
+	}
+	if errors.Is(err, venstar.ErrUnreachable) {
+		t.Errorf("HTTP error reported as unreachable: %v", err)
+	}
+}
+
+func TestMalformedResponse(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetMalformed("/query/info")
+	_, err = dev.Info()
+	var derr *venstar.DecodeError
+	if !errors.As(err, &derr) || derr.URL != srv.URL+"/query/info" {
+		t.Errorf("Info() = %v, want *DecodeError for %s/query/info", err, srv.URL)
+	}
+}
@@ -0,0 +1,198 @@
+package venstar
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// unmarshalExtra decodes data into v, which must be a pointer to a struct
+// type without its own UnmarshalJSON, and returns the keys in data that
+// none of its fields decoded.
+func unmarshalExtra(data []byte, v any) (map[string]json.RawMessage, error) {
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	rt := reflect.TypeOf(v).Elem()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" || sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		known[strings.ToLower(name)] = true
+	}
+	for key := range all {
+		if known[strings.ToLower(key)] {
+			delete(all, key)
+		}
+	}
+	if len(all) == 0 {
+		return nil, nil
+	}
+	return all, nil
+}
+
+// marshalExtra encodes v, which must not have its own MarshalJSON, with
+// the extra fields merged in.
+func marshalExtra(v any, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range extra {
+		if _, ok := all[key]; !ok {
+			all[key] = val
+		}
+	}
+	return json.Marshal(all)
+}
+
+func (info *DeviceInfo) UnmarshalJSON(data []byte) error {
+	type deviceInfo DeviceInfo
+	var v deviceInfo
+	extra, err := unmarshalExtra(data, &v)
+	if err != nil {
+		return err
+	}
+	*info = DeviceInfo(v)
+	info.Extra = extra
+	info.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func (info DeviceInfo) MarshalJSON() ([]byte, error) {
+	type deviceInfo DeviceInfo
+	return marshalExtra(deviceInfo(info), info.Extra)
+}
+
+// Raw returns the JSON the device info was decoded from.
+func (info *DeviceInfo) Raw() json.RawMessage {
+	return info.raw
+}
+
+// extraValues renders the passthrough keys present in Extra as form
+// values.
+func (info *DeviceInfo) extraValues(keys []string) url.Values {
+	var vals url.Values
+	for _, key := range keys {
+		raw, ok := info.Extra[key]
+		if !ok {
+			continue
+		}
+		if s, ok := formValue(raw); ok {
+			vals = withField(vals, key, s)
+		}
+	}
+	return vals
+}
+
+func (info *SensorInfo) UnmarshalJSON(data []byte) error {
+	type sensorInfo SensorInfo
+	var v sensorInfo
+	extra, err := unmarshalExtra(data, &v)
+	if err != nil {
+		return err
+	}
+	*info = SensorInfo(v)
+	info.Extra = extra
+	info.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func (info SensorInfo) MarshalJSON() ([]byte, error) {
+	type sensorInfo SensorInfo
+	return marshalExtra(sensorInfo(info), info.Extra)
+}
+
+// Raw returns the JSON the sensor info was decoded from.
+func (info *SensorInfo) Raw() json.RawMessage {
+	return info.raw
+}
+
+func (info *RuntimeInfo) UnmarshalJSON(data []byte) error {
+	type runtimeInfo RuntimeInfo
+	var v runtimeInfo
+	extra, err := unmarshalExtra(data, &v)
+	if err != nil {
+		return err
+	}
+	*info = RuntimeInfo(v)
+	info.Extra = extra
+	return nil
+}
+
+func (info RuntimeInfo) MarshalJSON() ([]byte, error) {
+	type runtimeInfo RuntimeInfo
+	return marshalExtra(runtimeInfo(info), info.Extra)
+}
+
+func (info *AlertInfo) UnmarshalJSON(data []byte) error {
+	type alertInfo AlertInfo
+	var v alertInfo
+	extra, err := unmarshalExtra(data, &v)
+	if err != nil {
+		return err
+	}
+	*info = AlertInfo(v)
+	info.Extra = extra
+	return nil
+}
+
+func (info AlertInfo) MarshalJSON() ([]byte, error) {
+	type alertInfo AlertInfo
+	return marshalExtra(alertInfo(info), info.Extra)
+}
+
+// formValue renders a scalar JSON value the way it would be sent in a
+// form. Objects and arrays cannot be sent and are rejected.
+func formValue(raw json.RawMessage) (string, bool) {
+	var v any
+	if json.Unmarshal(raw, &v) != nil {
+		return "", false
+	}
+	switch x := v.(type) {
+	case string:
+		return x, true
+	case float64, bool:
+		return strings.TrimSpace(string(raw)), true
+	}
+	return "", false
+}
+
+func withField(vals url.Values, name, value string) url.Values {
+	out := url.Values{}
+	for k, v := range vals {
+		out[k] = v
+	}
+	out.Set(name, value)
+	return out
+}
+
+type extraFields interface {
+	extraFields() url.Values
+}
+
+func (msg ControlMessage) extraFields() url.Values {
+	return msg.Extra
+}
+
+func (msg SettingsMessage) extraFields() url.Values {
+	return msg.Extra
+}
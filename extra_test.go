@@ -0,0 +1,103 @@
+package venstar_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestDeviceInfoExtra(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithName("HALL"))
+	defer srv.Close()
+	srv.Update(func(info *venstar.DeviceInfo) {
+		info.Extra = map[string]json.RawMessage{
+			"ecomode": json.RawMessage(`1`),
+			"newname": json.RawMessage(`"x"`),
+			"nested":  json.RawMessage(`{"a":1}`),
+		}
+	})
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := dev.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Extra) != 3 || string(info.Extra["ecomode"]) != "1" || string(info.Extra["newname"]) != `"x"` {
+		t.Errorf("Extra = %s, want only the unknown keys", info.Extra)
+	}
+	var raw map[string]any
+	err = json.Unmarshal(info.Raw(), &raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw["name"] != "HALL" || raw["ecomode"] != 1.0 {
+		t.Errorf("Raw() = %s, want everything the device sent", info.Raw())
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded venstar.DeviceInfo
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Name != "HALL" || !reflect.DeepEqual(decoded.Extra, info.Extra) {
+		t.Errorf("round trip through %s lost fields", data)
+	}
+
+	// only scalar passthrough fields can be written back
+	msg := info.ControlMessage("ecomode", "nested", "missing")
+	if want := (url.Values{"ecomode": {"1"}}); !reflect.DeepEqual(msg.Extra, want) {
+		t.Errorf("passthrough Extra = %v, want %v", msg.Extra, want)
+	}
+}
+
+func TestWriteExtraFields(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dev.PatchSettings(venstar.SettingsUpdate{}.WithField("ecomode", "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forms := srv.Forms("/settings")
+	if want := (url.Values{"ecomode": {"0"}}); len(forms) != 1 || !reflect.DeepEqual(forms[0], want) {
+		t.Errorf("settings forms = %v, want %v", forms, want)
+	}
+}
+
+func TestSensorExtra(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	srv.SetSensors([]*venstar.SensorInfo{{
+		Name:  "Thermostat",
+		Temp:  71,
+		Extra: map[string]json.RawMessage{"rssi": json.RawMessage(`-60`)},
+	}})
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensors, err := dev.Sensors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor := sensors["Thermostat"]
+	if sensor == nil || sensor.Temp != 71 || string(sensor.Extra["rssi"]) != "-60" {
+		t.Fatalf("sensors = %v, want Thermostat with rssi -60", sensors)
+	}
+	if len(sensor.Raw()) == 0 {
+		t.Error("Raw() is empty")
+	}
+}
@@ -0,0 +1,124 @@
+package venstar
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// EncodeForm encodes the exported fields of the struct v as form values.
+// Field names come from the form tag, then the json tag, and otherwise the
+// snake cased field name; a name of "-" skips the field and omitempty
+// skips zero values. Nil pointer fields are left out and non-nil ones are
+// always sent, so pointers express optional values. Numeric and bool
+// kinds are sent as numbers even when the type implements
+// encoding.TextMarshaler, since that is what the device expects for its
+// enums; other types use MarshalText when they implement it.
+func EncodeForm(v any) (url.Values, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, errors.New("nil input")
+	}
+	rt := rv.Type()
+	vals := url.Values{}
+	for rt.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, errors.New("nil input")
+		}
+		rv = rv.Elem()
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return nil, errors.New("input is not a struct")
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		var name string
+		var omitempty bool
+		tag, ok := sf.Tag.Lookup("form")
+		if !ok {
+			tag = sf.Tag.Get("json")
+		}
+		parts := strings.Split(tag, ",")
+		name = parts[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = toSnakeCase(sf.Name)
+		}
+		for _, part := range parts[1:] {
+			if part == "omitempty" {
+				omitempty = true
+			}
+		}
+		field := rv.Field(i)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+			omitempty = false
+		}
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			iv := field.Int()
+			if omitempty && iv == 0 {
+				continue
+			}
+			vals.Add(name, strconv.FormatInt(iv, 10))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			uv := field.Uint()
+			if omitempty && uv == 0 {
+				continue
+			}
+			vals.Add(name, strconv.FormatUint(uv, 10))
+		case reflect.Float64, reflect.Float32:
+			fv := field.Float()
+			if omitempty && fv == 0 {
+				continue
+			}
+			vals.Add(name, strconv.FormatFloat(fv, 'f', -1, 64))
+		case reflect.Bool:
+			bv := field.Bool()
+			if omitempty && !bv {
+				continue
+			}
+			vals.Add(name, strconv.FormatBool(bv))
+		default:
+			if field.Type().Implements(textMarshalerType) {
+				if omitempty && field.IsZero() {
+					continue
+				}
+				text, err := field.Interface().(encoding.TextMarshaler).MarshalText()
+				if err != nil {
+					return nil, fmt.Errorf("error encoding field %s: %w", sf.Name, err)
+				}
+				vals.Add(name, string(text))
+			} else if field.Kind() == reflect.String {
+				s := field.String()
+				if omitempty && s == "" {
+					continue
+				}
+				vals.Add(name, s)
+			} else {
+				return nil, fmt.Errorf("unsupported field %s type %T", sf.Name, field.Interface())
+			}
+		}
+	}
+	if ex, ok := v.(extraFields); ok {
+		for name, values := range ex.extraFields() {
+			vals[name] = values
+		}
+	}
+	return vals, nil
+}
@@ -0,0 +1,72 @@
+package venstar_test
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/rclancey/venstar"
+)
+
+type formSample struct {
+	Mode     venstar.ThermostatMode `json:"mode"`
+	HeatTemp float64                `form:"heattemp" json:"ignored"`
+	FanSpeed int
+	Note     string                `form:"note,omitempty"`
+	Away     *venstar.AwayState    `form:"away,omitempty"`
+	Holiday  *venstar.HolidayState `form:"holiday"`
+	Skip     string                `form:"-"`
+	Enabled  bool                  `form:"enabled"`
+	hidden   string
+}
+
+func TestEncodeForm(t *testing.T) {
+	away := venstar.AwayState(0)
+	v := formSample{
+		Mode:     venstar.ModeHeat,
+		HeatTemp: 68.5,
+		FanSpeed: 3,
+		Away:     &away,
+		Skip:     "skipped",
+		Enabled:  true,
+		hidden:   "hidden",
+	}
+	want := url.Values{
+		"mode":      {"1"},
+		"heattemp":  {"68.5"},
+		"fan_speed": {"3"},
+		"away":      {"0"},
+		"enabled":   {"true"},
+	}
+	for _, in := range []any{v, &v} {
+		got, err := venstar.EncodeForm(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("EncodeForm(%T) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestEncodeFormExtraFields(t *testing.T) {
+	msg := venstar.ControlMessage{Mode: venstar.ModeCool, HeatTemp: 68, CoolTemp: 74}.WithField("custom", "yes")
+	got, err := venstar.EncodeForm(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{"mode": "2", "heattemp": "68", "cooltemp": "74", "custom": "yes"} {
+		if got.Get(name) != value {
+			t.Errorf("%s = %q, want %q", name, got.Get(name), value)
+		}
+	}
+}
+
+func TestEncodeFormRejectsNonStructs(t *testing.T) {
+	var nilPtr *formSample
+	for _, in := range []any{nil, nilPtr, 42, map[string]string{}} {
+		if _, err := venstar.EncodeForm(in); err == nil {
+			t.Errorf("EncodeForm(%#v) succeeded", in)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package venstar
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultMaxAge is used when an announcement has no usable
+// CACHE-CONTROL max-age, as recommended by UPnP.
+const defaultMaxAge = 1800 * time.Second
+
+type EventType int
+
+const (
+	Appeared EventType = iota
+	Updated
+	Disappeared
+)
+
+var eventTypeNames = map[EventType]string{
+	Appeared:    "appeared",
+	Updated:     "updated",
+	Disappeared: "disappeared",
+}
+
+func (t EventType) String() string {
+	s, ok := eventTypeNames[t]
+	if !ok {
+		return fmt.Sprintf("EventType%d", t)
+	}
+	return s
+}
+
+// Event reports a change in the set of thermostats announcing themselves.
+// For Disappeared events Device is the last one announced, and Expired is
+// set when its max-age ran out rather than it saying byebye.
+type Event struct {
+	Type    EventType
+	Device  *Device
+	Expired bool
+}
+
+type monitored struct {
+	dev     *Device
+	expires time.Time
+}
+
+// Monitor listens for NOTIFY announcements until ctx is done. The options
+// are applied to every device announced.
+func Monitor(ctx context.Context, opts ...Option) (chan Event, error) {
+	d := &Discoverer{Options: opts}
+	return d.Monitor(ctx)
+}
+
+// Monitor joins the SSDP multicast group on Interface, or the interface
+// named by Target's zone, or every multicast interface that is up, like
+// Discover, and reports thermostats as they announce themselves, change
+// address or name, say byebye or stop refreshing their announcements. If
+// Target is not a multicast address Monitor listens on it directly. The
+// channel is closed when ctx is done.
+func (d *Discoverer) Monitor(ctx context.Context) (chan Event, error) {
+	conns, err := d.listenNotify()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Event, 10)
+	m := &monitor{
+		d:       d,
+		ch:      ch,
+		devices: map[string]*monitored{},
+	}
+	go m.run(ctx, conns)
+	return ch, nil
+}
+
+// listenNotify returns a socket joined to the group on each interface to
+// monitor. An interface that cannot join is skipped, and the system
+// default interface is used if there are none.
+func (d *Discoverer) listenNotify() ([]*net.UDPConn, error) {
+	group := d.target()
+	if !group.IP.IsMulticast() {
+		conn, err := net.ListenUDP(d.network(), group)
+		if err != nil {
+			return nil, err
+		}
+		return []*net.UDPConn{conn}, nil
+	}
+	ifaces, err := d.interfaces()
+	if err != nil {
+		return nil, err
+	}
+	if len(ifaces) == 0 {
+		conn, err := net.ListenMulticastUDP(d.network(), nil, group)
+		if err != nil {
+			return nil, err
+		}
+		return []*net.UDPConn{conn}, nil
+	}
+	var conns []*net.UDPConn
+	for i := range ifaces {
+		conn, lerr := net.ListenMulticastUDP(d.network(), &ifaces[i], group)
+		if lerr != nil {
+			log.Println("error joining ssdp group on", ifaces[i].Name+":", lerr)
+			err = lerr
+			continue
+		}
+		conns = append(conns, conn)
+	}
+	if len(conns) == 0 {
+		return nil, err
+	}
+	return conns, nil
+}
+
+type monitor struct {
+	d       *Discoverer
+	ch      chan Event
+	mu      sync.Mutex
+	devices map[string]*monitored
+}
+
+func (m *monitor) run(ctx context.Context, conns []*net.UDPConn) {
+	defer close(m.ch)
+	ctx, cancel := context.WithCancel(ctx)
+	var expiring sync.WaitGroup
+	expiring.Add(1)
+	go func() {
+		defer expiring.Done()
+		m.expire(ctx)
+	}()
+	var readers sync.WaitGroup
+	for _, conn := range conns {
+		readers.Add(1)
+		go func(conn *net.UDPConn) {
+			defer readers.Done()
+			m.read(ctx, conn)
+		}(conn)
+	}
+	readers.Wait()
+	cancel()
+	expiring.Wait()
+}
+
+// read handles announcements received on conn until ctx is done. The
+// same announcement may arrive on several sockets, which only refreshes
+// it.
+func (m *monitor) read(ctx context.Context, conn *net.UDPConn) {
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.SetDeadline(time.Now())
+	}()
+	buf := make([]byte, 1500)
+	for {
+		n, src, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrDeadlineExceeded) && ctx.Err() == nil {
+				log.Println("monitor read error:", err)
+			}
+			return
+		}
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		m.handle(ctx, msg, src)
+	}
+}
+
+func (m *monitor) handle(ctx context.Context, msg []byte, src net.Addr) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(msg)))
+	if err != nil || req.Method != "NOTIFY" {
+		return
+	}
+	req.Body.Close()
+	if req.Header.Get("NT") != SearchTarget {
+		return
+	}
+	switch req.Header.Get("NTS") {
+	case "ssdp:alive":
+		dev, err := deviceFromHeader(req.Header, m.d.Options)
+		if err != nil {
+			log.Println("error parsing announcement:", err)
+			return
+		}
+		dev.BaseURL = zoneURL(dev.BaseURL, src)
+		m.alive(ctx, dev, maxAge(req.Header))
+	case "ssdp:byebye":
+		id, err := parseUSN(req.Header.Get("USN"))
+		if err != nil {
+			log.Println("error parsing byebye:", err)
+			return
+		}
+		m.byebye(ctx, id.mac.String())
+	}
+}
+
+func (m *monitor) alive(ctx context.Context, dev *Device, age time.Duration) {
+	key := deviceKey(dev)
+	m.mu.Lock()
+	prev, ok := m.devices[key]
+	entry := &monitored{dev: dev, expires: time.Now().Add(age)}
+	typ := Appeared
+	if ok {
+		typ = Updated
+		if prev.dev.URL().String() == dev.URL().String() && prev.dev.Name == dev.Name {
+			// a refresh of the same announcement only extends its life
+			prev.expires = entry.expires
+			m.mu.Unlock()
+			return
+		}
+	}
+	m.devices[key] = entry
+	m.mu.Unlock()
+	m.send(ctx, Event{Type: typ, Device: dev})
+}
+
+func (m *monitor) byebye(ctx context.Context, key string) {
+	m.mu.Lock()
+	prev, ok := m.devices[key]
+	delete(m.devices, key)
+	m.mu.Unlock()
+	if ok {
+		m.send(ctx, Event{Type: Disappeared, Device: prev.dev})
+	}
+}
+
+func (m *monitor) expire(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var expired []*Device
+			m.mu.Lock()
+			for key, entry := range m.devices {
+				if now.After(entry.expires) {
+					expired = append(expired, entry.dev)
+					delete(m.devices, key)
+				}
+			}
+			m.mu.Unlock()
+			for _, dev := range expired {
+				m.send(ctx, Event{Type: Disappeared, Device: dev, Expired: true})
+			}
+		}
+	}
+}
+
+func (m *monitor) send(ctx context.Context, ev Event) {
+	select {
+	case m.ch <- ev:
+	case <-ctx.Done():
+	}
+}
+
+// maxAge returns the max-age directive of a CACHE-CONTROL header.
+func maxAge(h http.Header) time.Duration {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(k), "max-age") {
+			continue
+		}
+		secs, err := strconv.Atoi(strings.TrimSpace(v))
+		if err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return defaultMaxAge
+}
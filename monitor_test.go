@@ -0,0 +1,106 @@
+package venstar_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+// freeUDPAddr returns a loopback address nothing is listening on.
+func freeUDPAddr(t *testing.T) *net.UDPAddr {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+func TestMonitor(t *testing.T) {
+	r, err := venstartest.NewSSDPResponder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	addr := freeUDPAddr(t)
+	d := &venstar.Discoverer{Target: addr}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := d.Monitor(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func(timeout time.Duration) venstar.Event {
+		t.Helper()
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatal("events closed early")
+			}
+			return ev
+		case <-time.After(timeout):
+		}
+		t.Fatal("no event")
+		return venstar.Event{}
+	}
+	check := func(ev venstar.Event, typ venstar.EventType, name, location string) {
+		t.Helper()
+		if ev.Type != typ || ev.Device.Name != name || ev.Device.URL().String() != location {
+			t.Errorf("got %s %s, want %s %s: %s", ev.Type, ev.Device, typ, name, location)
+		}
+	}
+	alive := func(resp venstartest.SSDPResponse) {
+		t.Helper()
+		if err := r.Alive(addr, resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	alive(venstartest.NonVenstarResponse("http://127.0.0.1:9/"))
+	hall := venstartest.VenstarResponse("http://127.0.0.1:1/", "00:23:75:aa:bb:cc", "HALL", "residential")
+	alive(hall)
+	check(next(time.Second), venstar.Appeared, "HALL", "http://127.0.0.1:1/")
+
+	// a plain refresh reports nothing, so the next event is the move
+	alive(hall)
+	moved := hall
+	moved.Location = "http://127.0.0.1:2/"
+	alive(moved)
+	check(next(time.Second), venstar.Updated, "HALL", "http://127.0.0.1:2/")
+
+	renamed := venstartest.VenstarResponse(moved.Location, "00:23:75:aa:bb:cc", "Hallway", "residential")
+	alive(renamed)
+	check(next(time.Second), venstar.Updated, "Hallway", "http://127.0.0.1:2/")
+
+	if err := r.ByeBye(addr, renamed); err != nil {
+		t.Fatal(err)
+	}
+	ev := next(time.Second)
+	check(ev, venstar.Disappeared, "Hallway", "http://127.0.0.1:2/")
+	if ev.Expired {
+		t.Error("byebye reported as expired")
+	}
+
+	attic := venstartest.VenstarResponse("http://127.0.0.1:3/", "00:23:75:aa:bb:cd", "Attic", "residential")
+	attic.MaxAge = 1
+	alive(attic)
+	check(next(time.Second), venstar.Appeared, "Attic", "http://127.0.0.1:3/")
+	start := time.Now()
+	ev = next(3 * time.Second)
+	check(ev, venstar.Disappeared, "Attic", "http://127.0.0.1:3/")
+	if !ev.Expired {
+		t.Error("expiry not reported as expired")
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("expired after %s, before its max-age", elapsed)
+	}
+
+	cancel()
+	for range events {
+	}
+}
@@ -0,0 +1,94 @@
+package venstar_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestResidentialAway(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dev.SetAway(venstar.AwayStateAway)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if away := srv.Info().Away; away != venstar.AwayStateAway {
+		t.Errorf("Away = %v, want away", away)
+	}
+	for name, fn := range map[string]func() error{
+		"StartOverride":      func() error { return dev.StartOverride(time.Hour) },
+		"CancelOverride":     dev.CancelOverride,
+		"SetForceUnoccupied": func() error { return dev.SetForceUnoccupied(venstar.ForceUnoccOn) },
+		"SetHoliday":         func() error { return dev.SetHoliday(venstar.HolidayStateHoliday) },
+	} {
+		err := fn()
+		var uerr *venstar.UnsupportedError
+		if !errors.Is(err, venstar.ErrUnsupported) || !errors.As(err, &uerr) {
+			t.Errorf("%s on a residential thermostat = %v, want ErrUnsupported", name, err)
+		}
+	}
+	if n := len(srv.Forms("/settings")); n != 1 {
+		t.Errorf("%d settings writes, want only the away one", n)
+	}
+}
+
+func TestCommercialOccupancy(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithType(venstar.DeviceTypeCommercial))
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dev.SetAway(venstar.AwayStateAway)
+	if !errors.Is(err, venstar.ErrUnsupported) {
+		t.Errorf("SetAway on a commercial thermostat = %v, want ErrUnsupported", err)
+	}
+	if n := len(srv.Forms("/settings")); n != 0 {
+		t.Errorf("%d settings writes, want none", n)
+	}
+
+	err = dev.StartOverride(89*time.Minute + time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := srv.Info()
+	if info.Override != venstar.OverrideStateOn || info.OverrideTime != 90 {
+		t.Errorf("override %v for %d minutes, want on for 90", info.Override, info.OverrideTime)
+	}
+	err = dev.CancelOverride()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info = srv.Info()
+	if info.Override != venstar.OverrideStateOff || info.OverrideTime != 0 {
+		t.Errorf("override %v for %d minutes after cancel, want off", info.Override, info.OverrideTime)
+	}
+	err = dev.StartOverride(0)
+	var verr *venstar.ValidationError
+	if !errors.As(err, &verr) || verr.Field != "overridetime" {
+		t.Errorf("StartOverride(0) = %v, want *ValidationError", err)
+	}
+
+	err = dev.SetForceUnoccupied(venstar.ForceUnoccOn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := srv.Info().ForceUnocc; state != venstar.ForceUnoccOn {
+		t.Errorf("ForceUnocc = %v, want on", state)
+	}
+	err = dev.SetHoliday(venstar.HolidayStateHoliday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := srv.Info().Holiday; state != venstar.HolidayStateHoliday {
+		t.Errorf("Holiday = %v, want holiday", state)
+	}
+}
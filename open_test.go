@@ -0,0 +1,44 @@
+package venstar_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestOpen(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithName("HALL"), venstartest.WithType(venstar.DeviceTypeCommercial))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	for _, addr := range []string{srv.URL, srv.URL + "/", host, " " + host + " "} {
+		dev, err := venstar.Open(addr)
+		if err != nil {
+			t.Errorf("Open(%q): %v", addr, err)
+			continue
+		}
+		if dev.Name != "HALL" || dev.Type != venstar.DeviceTypeCommercial || dev.URL().String() != srv.URL+"/" {
+			t.Errorf("Open(%q) = %s of type %s", addr, dev, dev.Type)
+		}
+	}
+}
+
+func TestOpenNotThermostat(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+	_, err := venstar.Open(srv.URL)
+	if !errors.Is(err, venstar.ErrNotThermostat) {
+		t.Errorf("Open of another http server = %v, want ErrNotThermostat", err)
+	}
+	_, err = venstar.Open("ftp://" + strings.TrimPrefix(srv.URL, "http://"))
+	if err == nil {
+		t.Error("Open of an ftp url succeeded")
+	}
+}
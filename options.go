@@ -0,0 +1,138 @@
+package venstar
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Option func(*Device)
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(dev *Device) {
+		dev.client = client
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(dev *Device) {
+		dev.timeout = timeout
+	}
+}
+
+func WithCredentials(username, password string) Option {
+	return func(dev *Device) {
+		dev.username = username
+		dev.password = password
+	}
+}
+
+// WithPIN sets the screen lock PIN required by locked thermostats for
+// control and settings writes.
+func WithPIN(pin string) Option {
+	return func(dev *Device) {
+		dev.pin = pin
+	}
+}
+
+// WithClamping makes setpoint changes adjust out of range values to the
+// nearest legal ones instead of failing validation. Any adjustments made
+// are passed to report, which may be nil.
+func WithClamping(report func([]Adjustment)) Option {
+	return func(dev *Device) {
+		dev.clamp = true
+		dev.onClamp = report
+	}
+}
+
+// WithVerify makes every write re-read the device state after waiting
+// delay, and resend up to retries times if the device has not applied it.
+// Writes that are still not applied fail with a *NotAppliedError.
+func WithVerify(retries int, delay time.Duration) Option {
+	return func(dev *Device) {
+		dev.verify = true
+		dev.verifyRetries = retries
+		dev.verifyDelay = delay
+	}
+}
+
+// WithHTTPS makes the device use https even when it was discovered or
+// addressed with an http URL. Without it such devices are still upgraded
+// to https when their port refuses plain http or answers it with a 400
+// Bad Request naming HTTPS, but only after that first request fails.
+func WithHTTPS() Option {
+	return func(dev *Device) {
+		dev.forceHTTPS = true
+	}
+}
+
+// WithCertificatePin only accepts a device certificate whose SHA-256
+// fingerprint matches the hex encoded fingerprint given.
+func WithCertificatePin(fingerprint string) Option {
+	return func(dev *Device) {
+		dev.fingerprint = normalizeFingerprint(fingerprint)
+	}
+}
+
+// WithTrustOnFirstUse accepts whatever certificate the device presents on
+// the first https connection when no pin is set, and hands its fingerprint
+// to store, if not nil, so it can be passed to WithCertificatePin next
+// time.
+func WithTrustOnFirstUse(store func(fingerprint string) error) Option {
+	return func(dev *Device) {
+		dev.trustOnFirstUse = true
+		dev.onFirstUse = store
+	}
+}
+
+// WithResolver makes the device look itself up with resolve after the
+// given number of consecutive connection failures, 3 if not positive, and
+// move to the address found. Moves are reported to notify, or logged if
+// it is nil.
+func WithResolver(resolve Resolver, failures int, notify func(Move)) Option {
+	return func(dev *Device) {
+		if failures <= 0 {
+			failures = 3
+		}
+		dev.resolve = resolve
+		dev.resolveAfter = failures
+		dev.resolving = make(chan struct{}, 1)
+		dev.onMove = notify
+	}
+}
+
+// parseAddr turns a host, IP address or URL into a device base URL. IPv6
+// zones may be escaped or not, as in Location headers.
+func parseAddr(addr string) (*url.URL, error) {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return nil, errors.New("empty device address")
+	}
+	if ip, err := netip.ParseAddr(addr); err == nil && ip.Is6() {
+		addr = "[" + strings.Replace(addr, "%", "%25", 1) + "]"
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := parseLocation(addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, errors.New("device address has no host: " + addr)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return nil, errors.New("unsupported device address scheme: " + u.Scheme)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u, nil
+}
@@ -0,0 +1,35 @@
+package venstar
+
+import "testing"
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+		host string
+	}{
+		{"192.168.1.20", "http://192.168.1.20/", "192.168.1.20"},
+		{"thermostat.local:8080", "http://thermostat.local:8080/", "thermostat.local"},
+		{"https://192.168.1.20/api?x=1#y", "https://192.168.1.20/api", "192.168.1.20"},
+		{"fd00::2", "http://[fd00::2]/", "fd00::2"},
+		{"fe80::1%eth0", "http://[fe80::1%25eth0]/", "fe80::1%eth0"},
+		{"[fe80::1%eth0]:8080", "http://[fe80::1%25eth0]:8080/", "fe80::1%eth0"},
+		{"http://[fe80::1%eth0]/", "http://[fe80::1%25eth0]/", "fe80::1%eth0"},
+		{"https://[fe80::1%25eth0]:443", "https://[fe80::1%25eth0]:443/", "fe80::1%eth0"},
+	}
+	for _, tt := range tests {
+		u, err := parseAddr(tt.addr)
+		if err != nil {
+			t.Errorf("parseAddr(%q): %v", tt.addr, err)
+			continue
+		}
+		if u.String() != tt.want || u.Hostname() != tt.host {
+			t.Errorf("parseAddr(%q) = %s with host %s, want %s with host %s", tt.addr, u, u.Hostname(), tt.want, tt.host)
+		}
+	}
+	for _, addr := range []string{"", "  ", "ftp://192.168.1.20/", "http://"} {
+		if u, err := parseAddr(addr); err == nil {
+			t.Errorf("parseAddr(%q) = %s, want error", addr, u)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package venstar
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+)
+
+// ControlUpdate is a partial control message. Only non-nil fields are
+// sent, except that the firmware needs both setpoints together, so
+// setting either one sends both.
+type ControlUpdate struct {
+	Mode     *ThermostatMode `form:"mode"`
+	Fan      *FanSetting     `form:"fan"`
+	HeatTemp *float64        `form:"heattemp"`
+	CoolTemp *float64        `form:"cooltemp"`
+	Extra    url.Values      `form:"-"`
+}
+
+func (u ControlUpdate) WithMode(mode ThermostatMode) ControlUpdate {
+	u.Mode = &mode
+	return u
+}
+
+func (u ControlUpdate) WithFan(fan FanSetting) ControlUpdate {
+	u.Fan = &fan
+	return u
+}
+
+func (u ControlUpdate) WithHeatTemp(temp float64) ControlUpdate {
+	u.HeatTemp = &temp
+	return u
+}
+
+func (u ControlUpdate) WithCoolTemp(temp float64) ControlUpdate {
+	u.CoolTemp = &temp
+	return u
+}
+
+func (u ControlUpdate) WithField(name, value string) ControlUpdate {
+	u.Extra = withField(u.Extra, name, value)
+	return u
+}
+
+// Apply returns msg with the fields set in u changed.
+func (u ControlUpdate) Apply(msg ControlMessage) ControlMessage {
+	if u.Mode != nil {
+		msg.Mode = *u.Mode
+	}
+	if u.Fan != nil {
+		msg.Fan = *u.Fan
+	}
+	if u.HeatTemp != nil {
+		msg.HeatTemp = *u.HeatTemp
+	}
+	if u.CoolTemp != nil {
+		msg.CoolTemp = *u.CoolTemp
+	}
+	for name := range u.Extra {
+		msg = msg.WithField(name, u.Extra.Get(name))
+	}
+	return msg
+}
+
+func (u ControlUpdate) extraFields() url.Values {
+	return u.Extra
+}
+
+// SettingsUpdate is a partial settings message. Only non-nil fields are
+// sent.
+type SettingsUpdate struct {
+	TempUnits          *TempUnits       `form:"tempunits"`
+	Schedule           *ScheduleState   `form:"schedule"`
+	HumidifySetpoint   *float64         `form:"hum_setpoint"`
+	DehumidifySetpoint *float64         `form:"dehum_setpoint"`
+	Away               *AwayState       `form:"away"`
+	Holiday            *HolidayState    `form:"holiday"`
+	Override           *OverrideState   `form:"override"`
+	OverrideTime       *int             `form:"overridetime"`
+	ForceUnocc         *ForceUnoccState `form:"forceunocc"`
+	Extra              url.Values       `form:"-"`
+}
+
+func (u SettingsUpdate) WithTempUnits(units TempUnits) SettingsUpdate {
+	u.TempUnits = &units
+	return u
+}
+
+func (u SettingsUpdate) WithSchedule(sched ScheduleState) SettingsUpdate {
+	u.Schedule = &sched
+	return u
+}
+
+func (u SettingsUpdate) WithHumidifySetpoint(setpoint float64) SettingsUpdate {
+	u.HumidifySetpoint = &setpoint
+	return u
+}
+
+func (u SettingsUpdate) WithDehumidifySetpoint(setpoint float64) SettingsUpdate {
+	u.DehumidifySetpoint = &setpoint
+	return u
+}
+
+func (u SettingsUpdate) WithAway(away AwayState) SettingsUpdate {
+	u.Away = &away
+	return u
+}
+
+func (u SettingsUpdate) WithHoliday(holiday HolidayState) SettingsUpdate {
+	u.Holiday = &holiday
+	return u
+}
+
+func (u SettingsUpdate) WithOverride(override OverrideState, minutes int) SettingsUpdate {
+	u.Override = &override
+	u.OverrideTime = &minutes
+	return u
+}
+
+func (u SettingsUpdate) WithForceUnocc(state ForceUnoccState) SettingsUpdate {
+	u.ForceUnocc = &state
+	return u
+}
+
+func (u SettingsUpdate) WithField(name, value string) SettingsUpdate {
+	u.Extra = withField(u.Extra, name, value)
+	return u
+}
+
+// Apply returns msg with the fields set in u changed.
+func (u SettingsUpdate) Apply(msg SettingsMessage) SettingsMessage {
+	if u.TempUnits != nil {
+		msg.TempUnits = *u.TempUnits
+	}
+	if u.Schedule != nil {
+		msg.Schedule = *u.Schedule
+	}
+	if u.HumidifySetpoint != nil {
+		msg.HumidifySetpoint = *u.HumidifySetpoint
+	}
+	if u.DehumidifySetpoint != nil {
+		msg.DehumidifySetpoint = *u.DehumidifySetpoint
+	}
+	if u.Away != nil {
+		msg = msg.WithAway(*u.Away)
+	}
+	if u.Holiday != nil {
+		msg = msg.WithHoliday(*u.Holiday)
+	}
+	if u.Override != nil {
+		override := *u.Override
+		msg.Override = &override
+	}
+	if u.OverrideTime != nil {
+		minutes := *u.OverrideTime
+		msg.OverrideTime = &minutes
+	}
+	if u.ForceUnocc != nil {
+		msg = msg.WithForceUnocc(*u.ForceUnocc)
+	}
+	for name := range u.Extra {
+		msg = msg.WithField(name, u.Extra.Get(name))
+	}
+	return msg
+}
+
+func (u SettingsUpdate) extraFields() url.Values {
+	return u.Extra
+}
+
+func (dev *Device) PatchControl(u ControlUpdate) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.PatchControlContext(ctx, u)
+}
+
+// PatchControlContext sends only the fields set in u. The current state
+// is only read when a setpoint changes, to fill in the other setpoint and
+// validate them.
+func (dev *Device) PatchControlContext(ctx context.Context, u ControlUpdate) error {
+	dev.updateMu.Lock()
+	defer dev.updateMu.Unlock()
+	if u.HeatTemp != nil || u.CoolTemp != nil {
+		info, err := dev.InfoContext(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting current settings: %w", err)
+		}
+		msg, err := dev.checkControl(info, u.Apply(info.ControlMessage()))
+		if err != nil {
+			return err
+		}
+		u = u.WithHeatTemp(msg.HeatTemp).WithCoolTemp(msg.CoolTemp)
+	}
+	check := func(info *DeviceInfo) []Mismatch {
+		return u.Apply(info.ControlMessage()).mismatches(info)
+	}
+	return dev.write(ctx, pendingWrite{path: "control", msg: u, check: check})
+}
+
+func (dev *Device) PatchSettings(u SettingsUpdate) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.PatchSettingsContext(ctx, u)
+}
+
+// PatchSettingsContext sends only the fields set in u, without reading
+// the current state first.
+func (dev *Device) PatchSettingsContext(ctx context.Context, u SettingsUpdate) error {
+	dev.updateMu.Lock()
+	defer dev.updateMu.Unlock()
+	w, err := dev.settingsWrite(ctx, u)
+	if err != nil {
+		return err
+	}
+	return dev.write(ctx, w)
+}
+
+// settingsWrite checks that the device supports every field set in u and
+// prepares it to be written.
+func (dev *Device) settingsWrite(ctx context.Context, u SettingsUpdate) (pendingWrite, error) {
+	humidity := u.HumidifySetpoint != nil || u.DehumidifySetpoint != nil
+	occupancy := u.Holiday != nil || u.Override != nil || u.OverrideTime != nil || u.ForceUnocc != nil
+	err := dev.requireSettings(ctx, humidity, u.Away != nil, occupancy)
+	if err != nil {
+		return pendingWrite{}, err
+	}
+	check := func(info *DeviceInfo) []Mismatch {
+		return u.Apply(info.SettingsMessage()).mismatches(info)
+	}
+	return pendingWrite{path: "settings", msg: u, check: check}, nil
+}
+
+// settingsDiff returns an update with only the fields of to that differ
+// from from.
+func settingsDiff(from, to SettingsMessage) SettingsUpdate {
+	var u SettingsUpdate
+	if to.TempUnits != from.TempUnits {
+		u = u.WithTempUnits(to.TempUnits)
+	}
+	if to.Schedule != from.Schedule {
+		u = u.WithSchedule(to.Schedule)
+	}
+	if to.HumidifySetpoint != from.HumidifySetpoint {
+		u = u.WithHumidifySetpoint(to.HumidifySetpoint)
+	}
+	if to.DehumidifySetpoint != from.DehumidifySetpoint {
+		u = u.WithDehumidifySetpoint(to.DehumidifySetpoint)
+	}
+	if to.Away != nil && !reflect.DeepEqual(to.Away, from.Away) {
+		away := *to.Away
+		u.Away = &away
+	}
+	if to.Holiday != nil && !reflect.DeepEqual(to.Holiday, from.Holiday) {
+		holiday := *to.Holiday
+		u.Holiday = &holiday
+	}
+	if to.Override != nil && !reflect.DeepEqual(to.Override, from.Override) {
+		override := *to.Override
+		u.Override = &override
+	}
+	if to.OverrideTime != nil && !reflect.DeepEqual(to.OverrideTime, from.OverrideTime) {
+		minutes := *to.OverrideTime
+		u.OverrideTime = &minutes
+	}
+	if to.ForceUnocc != nil && !reflect.DeepEqual(to.ForceUnocc, from.ForceUnocc) {
+		force := *to.ForceUnocc
+		u.ForceUnocc = &force
+	}
+	for name, vals := range to.Extra {
+		if !reflect.DeepEqual(vals, from.Extra[name]) {
+			if u.Extra == nil {
+				u.Extra = url.Values{}
+			}
+			u.Extra[name] = append([]string(nil), vals...)
+		}
+	}
+	return u
+}
@@ -0,0 +1,67 @@
+package venstar_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestPIN(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithPIN("1234"))
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dev.SetFanMode(venstar.FanSettingOn)
+	if !errors.Is(err, venstar.ErrPINRequired) || errors.Is(err, venstar.ErrPINIncorrect) {
+		t.Errorf("write without pin = %v, want ErrPINRequired", err)
+	}
+	var devErr *venstar.DeviceError
+	if !errors.As(err, &devErr) || devErr.Path != "/control" {
+		t.Errorf("write without pin = %v, want *DeviceError for /control", err)
+	}
+
+	dev.SetPIN("4321")
+	err = dev.SetSchedule(venstar.ScheduleDisabled)
+	if !errors.Is(err, venstar.ErrPINIncorrect) || errors.Is(err, venstar.ErrPINRequired) {
+		t.Errorf("write with wrong pin = %v, want ErrPINIncorrect", err)
+	}
+	var pinErr *venstar.PINError
+	if !errors.As(err, &pinErr) || !pinErr.Provided {
+		t.Errorf("write with wrong pin = %#v, want *PINError with Provided", err)
+	}
+	if srv.Info().FanSetting == venstar.FanSettingOn {
+		t.Error("rejected write was applied")
+	}
+
+	dev.SetPIN("1234")
+	err = dev.SetFanMode(venstar.FanSettingOn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fan := srv.Info().FanSetting; fan != venstar.FanSettingOn {
+		t.Errorf("FanSetting = %v, want on", fan)
+	}
+}
+
+func TestPINOption(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithPIN("1234"))
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL, venstar.WithPIN("1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pin := dev.PIN(); pin != "1234" {
+		t.Errorf("PIN() = %q, want 1234", pin)
+	}
+	err = dev.SetMode(venstar.ModeHeat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := srv.Info().Mode; mode != venstar.ModeHeat {
+		t.Errorf("Mode = %v, want heat", mode)
+	}
+}
@@ -0,0 +1,234 @@
+package venstar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RegistryEntry is what a Registry remembers about a device. MAC is empty
+// for devices that were opened by address or found by Scan.
+type RegistryEntry struct {
+	MAC      string    `json:"mac,omitempty"`
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	Model    string    `json:"model,omitempty"`
+	Firmware string    `json:"firmware,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+func (e *RegistryEntry) key() string {
+	if e.MAC != "" {
+		return e.MAC
+	}
+	return e.URL
+}
+
+// Registry is a cache of known devices kept in a JSON file, so devices
+// can be found by name or MAC without waiting on discovery, and found
+// again after their address changes.
+type Registry struct {
+	// Discoverer finds devices that are not cached or no longer answer
+	// at their cached address. Its Options are also applied to devices
+	// opened from the cache.
+	Discoverer Discoverer
+	// ProbeTimeout bounds the check of a cached address, 2 seconds if
+	// zero.
+	ProbeTimeout time.Duration
+	// DiscoverTimeout bounds re-discovery, 2 seconds if zero.
+	DiscoverTimeout time.Duration
+
+	path    string
+	mu      sync.Mutex
+	entries []RegistryEntry
+}
+
+// OpenRegistry loads the registry at path, which need not exist yet. The
+// options are applied to every device it returns.
+func OpenRegistry(path string, opts ...Option) (*Registry, error) {
+	r := &Registry{
+		Discoverer: Discoverer{Options: opts},
+		path:       path,
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return r, nil
+	}
+	err = json.Unmarshal(data, &r.entries)
+	if err != nil {
+		return nil, fmt.Errorf("error reading registry %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Entries returns a copy of every cached entry.
+func (r *Registry) Entries() []RegistryEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RegistryEntry(nil), r.entries...)
+}
+
+// Save writes the registry to its file, replacing it atomically.
+func (r *Registry) Save() error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.entries, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(r.path), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(data, '\n'))
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+// Remember records dev as seen now and saves the registry. The model and
+// firmware are fetched from the device, keeping the cached ones if that
+// fails.
+func (r *Registry) Remember(ctx context.Context, dev *Device) error {
+	entry := RegistryEntry{
+		Name:     dev.Name,
+		URL:      dev.URL().String(),
+		LastSeen: time.Now(),
+	}
+	if dev.MAC != nil {
+		entry.MAC = dev.MAC.String()
+	}
+	caps, err := dev.CapabilitiesContext(ctx)
+	if err == nil {
+		entry.Model = caps.Model
+		entry.Firmware = caps.Firmware
+	}
+	r.mu.Lock()
+	entries := []RegistryEntry{entry}
+	for _, e := range r.entries {
+		if e.key() == entry.key() {
+			if err != nil {
+				entry.Model = e.Model
+				entry.Firmware = e.Firmware
+				entries[0] = entry
+			}
+			continue
+		}
+		if entry.MAC != "" && e.MAC == "" && strings.EqualFold(e.Name, entry.Name) {
+			// the device was cached by address before its MAC was known
+			continue
+		}
+		entries = append(entries, e)
+	}
+	r.entries = entries
+	r.mu.Unlock()
+	return r.Save()
+}
+
+// FindByName returns the device with the given name, ignoring case. The
+// cached address is tried first, and the device is discovered again if it
+// is not cached or no longer answers there.
+func (r *Registry) FindByName(ctx context.Context, name string) (*Device, error) {
+	return r.find(ctx, func(e *RegistryEntry) bool {
+		return strings.EqualFold(e.Name, name)
+	}, func(ctx context.Context) (*Device, error) {
+		return r.Discoverer.FindByName(ctx, name)
+	})
+}
+
+// FindByMAC returns the device with the given MAC address. The cached
+// address is tried first, and the device is discovered again if it is not
+// cached or no longer answers there.
+func (r *Registry) FindByMAC(ctx context.Context, mac string) (*Device, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+	return r.find(ctx, func(e *RegistryEntry) bool {
+		return e.MAC == hw.String()
+	}, func(ctx context.Context) (*Device, error) {
+		return r.Discoverer.FindByMAC(ctx, hw.String())
+	})
+}
+
+func (r *Registry) find(ctx context.Context, match func(*RegistryEntry) bool, discover func(context.Context) (*Device, error)) (*Device, error) {
+	var cached *RegistryEntry
+	r.mu.Lock()
+	for i := range r.entries {
+		if match(&r.entries[i]) {
+			entry := r.entries[i]
+			cached = &entry
+			break
+		}
+	}
+	r.mu.Unlock()
+	if cached != nil {
+		dev, err := r.probe(ctx, cached)
+		if err == nil {
+			return dev, r.Remember(ctx, dev)
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	timeout := r.DiscoverTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	discoverCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dev, err := discover(discoverCtx)
+	if err != nil {
+		return nil, err
+	}
+	return dev, r.Remember(ctx, dev)
+}
+
+// probe opens the device at the cached address and checks that it is
+// still the same device, since DHCP may have given the address to
+// another thermostat.
+func (r *Registry) probe(ctx context.Context, entry *RegistryEntry) (*Device, error) {
+	timeout := r.ProbeTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dev, err := OpenContext(ctx, entry.URL, r.Discoverer.Options...)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(dev.Name, entry.Name) {
+		return nil, fmt.Errorf("device at %s is now %q, not %q", entry.URL, dev.Name, entry.Name)
+	}
+	if entry.MAC != "" {
+		dev.MAC, _ = net.ParseMAC(entry.MAC)
+	}
+	return dev, nil
+}
@@ -0,0 +1,168 @@
+package venstar_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+// openRegistry writes entries to a new registry file and opens it,
+// discovering with r.
+func openRegistry(t *testing.T, r *venstartest.SSDPResponder, entries ...venstar.RegistryEntry) *venstar.Registry {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "devices.json")
+	if entries != nil {
+		data, err := json.Marshal(entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reg, err := venstar.OpenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Discoverer.Target = r.Addr()
+	reg.DiscoverTimeout = 300 * time.Millisecond
+	return reg
+}
+
+func TestRegistryCacheHit(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithName("HALL"))
+	defer srv.Close()
+	r, err := venstartest.NewSSDPResponder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	reg := openRegistry(t, r, venstar.RegistryEntry{MAC: "00:23:75:aa:bb:cc", Name: "HALL", URL: srv.URL + "/"})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	dev, err := reg.FindByName(ctx, "hall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.URL().String() != srv.URL+"/" || dev.MAC.String() != "00:23:75:aa:bb:cc" {
+		t.Errorf("found %s with MAC %s", dev, dev.MAC)
+	}
+	if n := len(r.Searches()); n != 0 {
+		t.Errorf("%d searches for a cached device", n)
+	}
+	entries := reg.Entries()
+	if len(entries) != 1 || entries[0].Model != "COLORTOUCH" || entries[0].LastSeen.IsZero() {
+		t.Errorf("entries = %+v, want HALL refreshed", entries)
+	}
+}
+
+func TestRegistryRediscovers(t *testing.T) {
+	old := venstartest.NewServer(venstartest.WithName("HALL"))
+	old.Close()
+	srv := venstartest.NewServer(venstartest.WithName("HALL"))
+	defer srv.Close()
+	r, err := venstartest.NewSSDPResponder(srv.SSDPResponse("00:23:75:aa:bb:cc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	reg := openRegistry(t, r, venstar.RegistryEntry{MAC: "00:23:75:aa:bb:cc", Name: "HALL", URL: old.URL + "/"})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	dev, err := reg.FindByMAC(ctx, "00:23:75:AA:BB:CC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.URL().String() != srv.URL+"/" {
+		t.Errorf("found %s, want %s/", dev.URL(), srv.URL)
+	}
+	if n := len(r.Searches()); n == 0 {
+		t.Error("device at a dead address found without searching")
+	}
+	entries := reg.Entries()
+	if len(entries) != 1 || entries[0].URL != srv.URL+"/" {
+		t.Errorf("entries = %+v, want HALL at its new address", entries)
+	}
+}
+
+func TestRegistryRejectsReassignedAddress(t *testing.T) {
+	// DHCP gave HALL's old address to another thermostat
+	other := venstartest.NewServer(venstartest.WithName("Bedroom"))
+	defer other.Close()
+	srv := venstartest.NewServer(venstartest.WithName("HALL"))
+	defer srv.Close()
+	r, err := venstartest.NewSSDPResponder(srv.SSDPResponse("00:23:75:aa:bb:cc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	reg := openRegistry(t, r, venstar.RegistryEntry{Name: "HALL", URL: other.URL + "/"})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	dev, err := reg.FindByName(ctx, "HALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.Name != "HALL" || dev.URL().String() != srv.URL+"/" {
+		t.Errorf("found %s, want HALL at %s/", dev, srv.URL)
+	}
+	// the entry cached by address is replaced once the MAC is known
+	entries := reg.Entries()
+	if len(entries) != 1 || entries[0].MAC != "00:23:75:aa:bb:cc" {
+		t.Errorf("entries = %+v, want only HALL by MAC", entries)
+	}
+}
+
+func TestRegistrySaveRoundTrip(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithName("HALL"), venstartest.WithFirmware("7.01"))
+	defer srv.Close()
+	r, err := venstartest.NewSSDPResponder(srv.SSDPResponse("00:23:75:aa:bb:cc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	path := filepath.Join(t.TempDir(), "cache", "devices.json")
+	reg, err := venstar.OpenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := reg.Entries(); len(entries) != 0 {
+		t.Fatalf("new registry has entries %+v", entries)
+	}
+	reg.Discoverer.Target = r.Addr()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = reg.FindByName(ctx, "HALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := reg.Entries()
+
+	reopened, err := venstar.OpenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := reopened.Entries()
+	if len(loaded) != 1 || len(saved) != 1 {
+		t.Fatalf("saved %+v, loaded %+v", saved, loaded)
+	}
+	want := saved[0]
+	got := loaded[0]
+	if !got.LastSeen.Equal(want.LastSeen) {
+		t.Errorf("LastSeen = %s, want %s", got.LastSeen, want.LastSeen)
+	}
+	got.LastSeen = want.LastSeen
+	if got != want {
+		t.Errorf("loaded %+v, want %+v", got, want)
+	}
+	if want.MAC != "00:23:75:aa:bb:cc" || want.Firmware != "7.01" || want.URL != srv.URL+"/" {
+		t.Errorf("saved %+v", want)
+	}
+}
@@ -0,0 +1,166 @@
+package venstar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// resolveTimeout bounds a resolver call, within whatever is left of the
+// deadline of the request that triggered it.
+const resolveTimeout = 5 * time.Second
+
+// Resolver finds the current address of dev, for devices whose address
+// has changed since they were found. See WithResolver.
+type Resolver func(ctx context.Context, dev *Device) (*url.URL, error)
+
+// Move describes a device found at a new address by its resolver.
+type Move struct {
+	Name string
+	MAC  net.HardwareAddr
+	From *url.URL
+	To   *url.URL
+}
+
+func (m Move) String() string {
+	return fmt.Sprintf("%s moved from %s to %s", m.Name, m.From, m.To)
+}
+
+// DiscoverResolver finds devices again with d, by MAC if the device has
+// one and by name otherwise.
+func DiscoverResolver(d *Discoverer) Resolver {
+	return func(ctx context.Context, dev *Device) (*url.URL, error) {
+		var found *Device
+		var err error
+		if dev.MAC != nil {
+			found, err = d.FindByMAC(ctx, dev.MAC.String())
+		} else {
+			found, err = d.FindByName(ctx, dev.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return found.URL(), nil
+	}
+}
+
+// ScanResolver finds devices again by scanning cidr. Scanned devices have
+// no MAC, so they are matched by name.
+func ScanResolver(cidr string, opts ScanOptions) Resolver {
+	return func(ctx context.Context, dev *Device) (*url.URL, error) {
+		devs, err := Scan(ctx, cidr, opts)
+		for _, found := range devs {
+			if strings.EqualFold(found.Name, dev.Name) {
+				return found.URL(), nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+}
+
+// Resolver finds devices through the registry, which tries their cached
+// address before discovering them again.
+func (r *Registry) Resolver() Resolver {
+	return func(ctx context.Context, dev *Device) (*url.URL, error) {
+		var found *Device
+		var err error
+		if dev.MAC != nil {
+			found, err = r.FindByMAC(ctx, dev.MAC.String())
+		} else {
+			found, err = r.FindByName(ctx, dev.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return found.URL(), nil
+	}
+}
+
+// heal counts connection failures and, once there are enough in a row,
+// resolves the device's address again and retries req there if it moved.
+// Failures caused by the caller's context ending are not the device's
+// fault and are not counted.
+func (dev *Device) heal(req *http.Request, res *http.Response, err error) (*http.Response, error) {
+	if err == nil {
+		dev.mu.Lock()
+		dev.failures = 0
+		dev.mu.Unlock()
+		return res, nil
+	}
+	if req.Context().Err() != nil || errors.Is(err, context.Canceled) || isCertificateError(err) {
+		return res, err
+	}
+	dev.mu.Lock()
+	dev.failures++
+	failures := dev.failures
+	dev.mu.Unlock()
+	if failures < dev.resolveAfter {
+		return res, err
+	}
+	base, moved := dev.relocate(req.Context(), req.URL)
+	if !moved || req.Context().Err() != nil {
+		return res, err
+	}
+	u := *req.URL
+	u.Host = base.Host
+	retry, cerr := cloneRequest(req, &u)
+	if cerr != nil {
+		return res, err
+	}
+	return dev.send(retry)
+}
+
+// relocate runs the resolver and moves the device to the address found.
+// Only one resolution runs at a time, and one that finds the device has
+// already moved away from failed does not resolve again. Both waiting for
+// another resolution and resolving stop when ctx is done.
+func (dev *Device) relocate(ctx context.Context, failed *url.URL) (*url.URL, bool) {
+	select {
+	case dev.resolving <- struct{}{}:
+	case <-ctx.Done():
+		return nil, false
+	}
+	defer func() { <-dev.resolving }()
+	current := dev.URL()
+	if current.Host != failed.Host {
+		return current, true
+	}
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	u, err := dev.resolve(ctx, dev)
+	if err != nil {
+		log.Printf("venstar: unable to resolve %s after connection failures: %s", dev.Name, err)
+		return nil, false
+	}
+	dev.mu.Lock()
+	dev.failures = 0
+	from := dev.BaseURL
+	// keep the scheme, which may have been upgraded to https
+	moved := from.Host != u.Host
+	if moved {
+		to := *from
+		to.Host = u.Host
+		dev.BaseURL = &to
+	}
+	to := dev.BaseURL
+	dev.mu.Unlock()
+	if !moved {
+		return to, false
+	}
+	move := Move{Name: dev.Name, MAC: dev.MAC, From: from, To: to}
+	if dev.onMove != nil {
+		dev.onMove(move)
+	} else {
+		log.Println("venstar:", move)
+	}
+	return to, true
+}
@@ -0,0 +1,121 @@
+package venstar_test
+
+import (
+	"context"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestResolverRespectsContext(t *testing.T) {
+	srv := venstartest.NewServer()
+	resolve := func(ctx context.Context, dev *venstar.Device) (*url.URL, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	dev, err := venstar.Open(srv.URL, venstar.WithResolver(resolve, 1, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = dev.InfoContext(ctx)
+	if err == nil {
+		t.Fatal("Info succeeded against a closed server")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Info took %s with a 100ms deadline", elapsed)
+	}
+}
+
+func TestResolverMovesDevice(t *testing.T) {
+	old := venstartest.NewServer(venstartest.WithName("HALL"))
+	moved := venstartest.NewServer(venstartest.WithName("HALL"))
+	defer moved.Close()
+	resolve := func(ctx context.Context, dev *venstar.Device) (*url.URL, error) {
+		return url.Parse(moved.URL)
+	}
+	var moves []venstar.Move
+	dev, err := venstar.Open(old.URL, venstar.WithResolver(resolve, 2, func(m venstar.Move) {
+		moves = append(moves, m)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+	if _, err := dev.Info(); err == nil {
+		t.Fatal("first Info after the move succeeded")
+	}
+	if _, err := dev.Info(); err != nil {
+		t.Fatalf("second Info after the move: %v", err)
+	}
+	if dev.URL().String() != moved.URL+"/" || len(moves) != 1 {
+		t.Errorf("URL = %s after moves %v, want %s/", dev.URL(), moves, moved.URL)
+	}
+}
+
+func TestResolverIgnoresCallerDeadline(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	var calls atomic.Int32
+	resolve := func(ctx context.Context, dev *venstar.Device) (*url.URL, error) {
+		calls.Add(1)
+		return nil, venstar.ErrNotFound
+	}
+	dev, err := venstar.Open(srv.URL, venstar.WithResolver(resolve, 1, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetLatency(time.Second)
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = dev.InfoContext(ctx)
+		cancel()
+		if err == nil {
+			t.Fatal("Info succeeded past its deadline")
+		}
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("resolver called %d times for the caller's own deadlines", n)
+	}
+}
+
+func TestDiscoverResolverAfterTimeouts(t *testing.T) {
+	hung := venstartest.NewServer(venstartest.WithName("HALL"))
+	defer hung.Close()
+	moved := venstartest.NewServer(venstartest.WithName("HALL"))
+	defer moved.Close()
+	r, err := venstartest.NewSSDPResponder(moved.SSDPResponse("00:23:75:aa:bb:cc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	d := &venstar.Discoverer{Target: r.Addr()}
+	var moves []venstar.Move
+	dev, err := venstar.Open(hung.URL,
+		venstar.WithTimeout(100*time.Millisecond),
+		venstar.WithResolver(venstar.DiscoverResolver(d), 2, func(m venstar.Move) {
+			moves = append(moves, m)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// client timeouts from a hung device count as connection failures
+	hung.SetLatency(time.Second)
+	if _, err := dev.Info(); err == nil {
+		t.Fatal("Info from a hung device succeeded")
+	}
+	if _, err := dev.Info(); err != nil {
+		t.Fatalf("Info after the second timeout: %v", err)
+	}
+	if len(moves) != 1 || moves[0].To.String() != moved.URL+"/" || moves[0].Name != "HALL" {
+		t.Errorf("moves = %v, want HALL moved to %s/", moves, moved.URL)
+	}
+}
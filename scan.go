@@ -0,0 +1,110 @@
+package venstar
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// maxScanBits limits Scan to prefixes of at most 65536 addresses.
+const maxScanBits = 16
+
+// ScanOptions configures Scan. The zero value probes 32 hosts at a time
+// with a 2 second timeout each.
+type ScanOptions struct {
+	// Concurrency is the number of hosts probed at once.
+	Concurrency int
+	// Timeout bounds the probe of each host.
+	Timeout time.Duration
+	// Port is probed on each host instead of the scheme default.
+	Port int
+	// Progress, if set, is called after each host is probed with the
+	// number of hosts done so far and the total. Calls are serialized.
+	Progress func(done, total int)
+	// Options are applied to every device found.
+	Options []Option
+}
+
+// Scan probes every address in cidr over HTTP and returns the Venstar
+// thermostats found, sorted by name. It is a fallback for networks where
+// multicast discovery is filtered. Devices found this way have a Name and
+// Type but no MAC, since the API does not report one. If ctx is done
+// first the devices found so far are returned with ctx's error.
+func Scan(ctx context.Context, cidr string, opts ScanOptions) ([]*Device, error) {
+	addrs, err := scanAddrs(cidr)
+	if err != nil {
+		return nil, err
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 32
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		done int
+		devs = []*Device{}
+	)
+	sem := make(chan struct{}, concurrency)
+	for _, addr := range addrs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(addr netip.Addr) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			hostCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			host := addr.String()
+			if opts.Port > 0 {
+				host = netip.AddrPortFrom(addr, uint16(opts.Port)).String()
+			}
+			dev, err := OpenContext(hostCtx, host, opts.Options...)
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				devs = append(devs, dev)
+			}
+			done++
+			if opts.Progress != nil {
+				opts.Progress(done, len(addrs))
+			}
+		}(addr)
+	}
+	wg.Wait()
+	sortDevices(devs)
+	return devs, ctx.Err()
+}
+
+// scanAddrs lists the host addresses in cidr, leaving out the network
+// and broadcast addresses of IPv4 subnets larger than a /31.
+func scanAddrs(cidr string) ([]netip.Addr, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > maxScanBits {
+		return nil, fmt.Errorf("prefix %s is too large to scan", prefix)
+	}
+	var addrs []netip.Addr
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		addrs = append(addrs, addr)
+	}
+	if prefix.Addr().Is4() && hostBits > 1 {
+		addrs = addrs[1 : len(addrs)-1]
+	}
+	return addrs, nil
+}
@@ -0,0 +1,60 @@
+package venstar_test
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestScan(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithName("HALL"), venstartest.WithType(venstar.DeviceTypeCommercial))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	tests := []struct {
+		cidr  string
+		hosts int
+	}{
+		// the network and broadcast addresses are skipped
+		{"127.0.0.0/30", 2},
+		{"127.0.0.1/32", 1},
+		{"127.0.0.0/31", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			var done, total int
+			devs, err := venstar.Scan(context.Background(), tt.cidr, venstar.ScanOptions{
+				Port:    port,
+				Timeout: time.Second,
+				Progress: func(n, of int) {
+					done, total = n, of
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if done != tt.hosts || total != tt.hosts {
+				t.Errorf("progress %d/%d, want %d/%d", done, total, tt.hosts, tt.hosts)
+			}
+			if len(devs) != 1 {
+				t.Fatalf("found %v, want one device", devs)
+			}
+			if devs[0].Name != "HALL" || devs[0].Type != venstar.DeviceTypeCommercial {
+				t.Errorf("found %s (%s), want HALL (commercial)", devs[0].Name, devs[0].Type)
+			}
+		})
+	}
+}
+
+func TestScanRejectsLargePrefixes(t *testing.T) {
+	for _, cidr := range []string{"10.0.0.0/8", "fd00::/64", "not a prefix"} {
+		if _, err := venstar.Scan(context.Background(), cidr, venstar.ScanOptions{}); err == nil {
+			t.Errorf("Scan(%q) succeeded", cidr)
+		}
+	}
+}
@@ -2,59 +2,482 @@ package venstar
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"math/rand"
 	"net"
-	//"net/http"
-	//"net/url"
+	"net/netip"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-func Discover(timeout time.Duration) (chan *Device, error) {
-	raddr := &net.UDPAddr{
-		IP: net.ParseIP("239.255.255.250"),
+const SearchTarget = "venstar:thermostat:ecp"
+
+var SSDPAddr = &net.UDPAddr{
+	IP: net.ParseIP("239.255.255.250"),
+	Port: 1900,
+}
+
+// SSDPAddr6LinkLocal and SSDPAddr6SiteLocal are the IPv6 SSDP multicast
+// groups. Set one as a Discoverer's Target to search over IPv6.
+var (
+	SSDPAddr6LinkLocal = &net.UDPAddr{
+		IP: net.ParseIP("ff02::c"),
+		Port: 1900,
+	}
+	SSDPAddr6SiteLocal = &net.UDPAddr{
+		IP: net.ParseIP("ff05::c"),
 		Port: 1900,
 	}
+)
+
+// Discoverer searches for thermostats with SSDP. The zero value searches
+// the standard multicast group on every multicast capable interface.
+type Discoverer struct {
+	// Target is where M-SEARCH requests are sent, SSDPAddr if nil. An
+	// IPv6 Target searches over IPv6, and its zone, if any, selects the
+	// interface when Interface is nil.
+	Target *net.UDPAddr
+	// ListenAddr is the local address responses are received on. When it
+	// is set, or Target is not a multicast address, a single socket is
+	// used instead of one per interface.
+	ListenAddr string
+	// Interface restricts the search to one interface instead of all
+	// multicast capable ones.
+	Interface *net.Interface
+	// SearchTarget is the ST header sent, SearchTarget if empty.
+	SearchTarget string
+	// MX is the number of seconds devices may wait before answering, 2 if
+	// zero.
+	MX int
+	// Attempts is the number of times the M-SEARCH is sent, 3 if zero.
+	Attempts int
+	// Interval is the average time between attempts, 500ms if zero. Each
+	// wait is jittered by up to half the interval either way.
+	Interval time.Duration
+	// Options are applied to every device found.
+	Options []Option
+}
+
+func Discover(timeout time.Duration, opts ...Option) (chan *Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	d := &Discoverer{Options: opts}
+	ch, err := d.discover(ctx, cancel)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return ch, nil
+}
+
+// DiscoverContext searches for thermostats until ctx is done, so ctx
+// should normally carry a deadline. The options are applied to every
+// device found.
+func DiscoverContext(ctx context.Context, opts ...Option) (chan *Device, error) {
+	d := &Discoverer{Options: opts}
+	return d.Discover(ctx)
+}
+
+// Discover searches for thermostats until ctx is done, so ctx should
+// normally carry a deadline.
+func (d *Discoverer) Discover(ctx context.Context) (chan *Device, error) {
+	return d.discover(ctx, func() {})
+}
+
+func (d *Discoverer) target() *net.UDPAddr {
+	if d.Target != nil {
+		return d.Target
+	}
+	return SSDPAddr
+}
+
+func (d *Discoverer) request() []byte {
+	st := d.SearchTarget
+	if st == "" {
+		st = SearchTarget
+	}
+	mx := d.MX
+	if mx <= 0 {
+		mx = 2
+	}
 	reqBuf := bytes.NewBuffer(nil)
 	reqBuf.Write([]byte("M-SEARCH * HTTP/1.1\r\n"))
-	reqBuf.Write([]byte("HOST: "+raddr.String()+"\r\n"))
+	target := d.target()
+	host := net.JoinHostPort(target.IP.String(), strconv.Itoa(target.Port))
+	reqBuf.Write([]byte("HOST: "+host+"\r\n"))
 	reqBuf.Write([]byte("MAN: \"ssdp:discover\"\r\n"))
-	reqBuf.Write([]byte("ST: ssdp:all\r\n"))
-	reqBuf.Write([]byte("MX: 10\r\n"))
-	reqBuf.Write([]byte("\n"))
-	conn, err := net.ListenPacket("udp4", ":0")
+	reqBuf.Write([]byte("ST: "+st+"\r\n"))
+	reqBuf.Write([]byte("MX: "+strconv.Itoa(mx)+"\r\n"))
+	reqBuf.Write([]byte("\r\n"))
+	return reqBuf.Bytes()
+}
+
+func (d *Discoverer) network() string {
+	if d.target().IP.To4() == nil {
+		return "udp6"
+	}
+	return "udp4"
+}
+
+// interfaces returns the interfaces to search or listen on.
+func (d *Discoverer) interfaces() ([]net.Interface, error) {
+	if d.Interface != nil {
+		return []net.Interface{*d.Interface}, nil
+	}
+	if zone := d.target().Zone; zone != "" {
+		iface, err := net.InterfaceByName(zone)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Interface{*iface}, nil
+	}
+	all, err := net.Interfaces()
 	if err != nil {
 		return nil, err
 	}
-	ch := make(chan *Device, 10)
-	go func() {
-		defer conn.Close()
-		defer close(ch)
-		buf := make([]byte, 1500)
-		conn.SetDeadline(time.Now().Add(timeout))
-		for {
-			n, _, err := conn.ReadFrom(buf)
-			if err != nil {
-				if !errors.Is(err, os.ErrDeadlineExceeded) {
-					log.Println("listener read error:", err)
-				}
-				return
+	var ifaces []net.Interface
+	for _, iface := range all {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 && iface.Flags&net.FlagLoopback == 0 {
+			ifaces = append(ifaces, iface)
+		}
+	}
+	return ifaces, nil
+}
+
+// searchSocket is a local address to search from and where its searches
+// are sent.
+type searchSocket struct {
+	laddr string
+	raddr *net.UDPAddr
+	conn  net.PacketConn
+}
+
+// sockets returns the sockets to search from, one per interface. Binding
+// a socket to an interface address makes multicast go out on that
+// interface, and for IPv6 the zone of the target does the same.
+func (d *Discoverer) sockets() ([]*searchSocket, error) {
+	target := d.target()
+	if d.ListenAddr != "" || !target.IP.IsMulticast() {
+		laddr := d.ListenAddr
+		if laddr == "" {
+			laddr = ":0"
+		}
+		return []*searchSocket{{laddr: laddr, raddr: target}}, nil
+	}
+	ifaces, err := d.interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var socks []*searchSocket
+	for _, iface := range ifaces {
+		ip := interfaceAddr(iface, target.IP)
+		if ip == nil {
+			continue
+		}
+		host := ip.String()
+		raddr := *target
+		if ip.To4() == nil {
+			raddr.Zone = iface.Name
+			if ip.IsLinkLocalUnicast() {
+				host += "%" + iface.Name
 			}
-			info := make([]byte, n)
-			copy(info, buf[:n])
-			dev, err := NewDevice(info)
-			if err != nil {
-				log.Println("error parsing device:", err)
-			} else if dev != nil {
-				ch <- dev
+		}
+		socks = append(socks, &searchSocket{laddr: net.JoinHostPort(host, "0"), raddr: &raddr})
+	}
+	if len(socks) == 0 {
+		if d.Interface != nil {
+			return nil, fmt.Errorf("interface %s has no %s address", d.Interface.Name, d.network())
+		}
+		return []*searchSocket{{laddr: ":0", raddr: target}}, nil
+	}
+	return socks, nil
+}
+
+// interfaceAddr picks the address of iface to search group from: its
+// IPv4 address for IPv4 groups, its link-local address for link-local
+// IPv6 groups, and preferably a routable address for wider IPv6 groups.
+func interfaceAddr(iface net.Interface, group net.IP) net.IP {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var linkLocal net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipnet.IP
+		if group.To4() != nil {
+			if ip.To4() != nil {
+				return ip
 			}
+			continue
 		}
-	}()
-	_, err = conn.WriteTo(reqBuf.Bytes(), raddr)
+		if ip.To4() != nil {
+			continue
+		}
+		if ip.IsLinkLocalUnicast() {
+			if linkLocal == nil {
+				linkLocal = ip
+			}
+		} else if !group.IsLinkLocalMulticast() {
+			return ip
+		}
+	}
+	return linkLocal
+}
+
+func (d *Discoverer) discover(ctx context.Context, cancel context.CancelFunc) (chan *Device, error) {
+	socks, err := d.sockets()
 	if err != nil {
-		conn.Close()
 		return nil, err
 	}
+	var lc net.ListenConfig
+	req := d.request()
+	var sent []*searchSocket
+	for _, sock := range socks {
+		sock.conn, err = lc.ListenPacket(ctx, d.network(), sock.laddr)
+		if err != nil {
+			log.Println("error listening on", sock.laddr+":", err)
+			continue
+		}
+		_, err = sock.conn.WriteTo(req, sock.raddr)
+		if err != nil {
+			log.Println("error sending ssdp search from", sock.laddr+":", err)
+			sock.conn.Close()
+			continue
+		}
+		sent = append(sent, sock)
+	}
+	if len(sent) == 0 {
+		if err == nil {
+			err = errors.New("no interfaces to send ssdp search from")
+		}
+		return nil, err
+	}
+	ch := make(chan *Device, 10)
+	seen := &seenDevices{keys: map[string]bool{}}
+	var wg sync.WaitGroup
+	for _, sock := range sent {
+		wg.Add(1)
+		go func(conn net.PacketConn) {
+			defer wg.Done()
+			d.receive(ctx, conn, ch, seen)
+		}(sock.conn)
+	}
+	go d.retransmit(ctx, sent, req)
+	go func() {
+		wg.Wait()
+		close(ch)
+		cancel()
+	}()
 	return ch, nil
 }
+
+func (d *Discoverer) retransmit(ctx context.Context, socks []*searchSocket, req []byte) {
+	attempts := d.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	interval := d.Interval
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	for i := 1; i < attempts; i++ {
+		wait := interval/2 + time.Duration(rand.Int63n(int64(interval)+1))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		for _, sock := range socks {
+			// errors here mean the receiver has already closed the socket
+			sock.conn.WriteTo(req, sock.raddr)
+		}
+	}
+}
+
+func (d *Discoverer) receive(ctx context.Context, conn net.PacketConn, ch chan *Device, seen *seenDevices) {
+	done := make(chan struct{})
+	defer conn.Close()
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, src, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				log.Println("listener read error:", err)
+			}
+			return
+		}
+		info := make([]byte, n)
+		copy(info, buf[:n])
+		dev, err := NewDevice(info, d.Options...)
+		if err != nil {
+			log.Println("error parsing device:", err)
+			continue
+		}
+		if dev == nil {
+			continue
+		}
+		dev.BaseURL = zoneURL(dev.BaseURL, src)
+		if !seen.add(dev) {
+			continue
+		}
+		select {
+		case ch <- dev:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// zoneURL adds the zone of src to a link-local IPv6 host in u, since a
+// device cannot know what its host's interface is called.
+func zoneURL(u *url.URL, src net.Addr) *url.URL {
+	udp, ok := src.(*net.UDPAddr)
+	if !ok || udp.Zone == "" {
+		return u
+	}
+	ip, err := netip.ParseAddr(u.Hostname())
+	if err != nil || !ip.Is6() || ip.Zone() != "" || !ip.IsLinkLocalUnicast() {
+		return u
+	}
+	zoned := *u
+	zoned.Host = "[" + ip.WithZone(udp.Zone).String() + "]"
+	if port := u.Port(); port != "" {
+		zoned.Host += ":" + port
+	}
+	return &zoned
+}
+
+// seenDevices tracks which devices a search has already reported, since
+// retransmits and multiple interfaces produce repeated responses.
+type seenDevices struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (s *seenDevices) add(dev *Device) bool {
+	key := deviceKey(dev)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys[key] {
+		return false
+	}
+	s.keys[key] = true
+	return true
+}
+
+// deviceKey identifies a discovered device by its MAC address, falling
+// back to its URL.
+func deviceKey(dev *Device) string {
+	if dev.MAC != nil {
+		return dev.MAC.String()
+	}
+	return dev.URL().String()
+}
+
+// DiscoverAll searches for thermostats until ctx is done and returns every
+// device found, sorted by name. The options are applied to every device.
+func DiscoverAll(ctx context.Context, opts ...Option) ([]*Device, error) {
+	d := &Discoverer{Options: opts}
+	return d.DiscoverAll(ctx)
+}
+
+// DiscoverAll searches for thermostats until ctx is done and returns every
+// device found, sorted by name.
+func (d *Discoverer) DiscoverAll(ctx context.Context) ([]*Device, error) {
+	ch, err := d.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	devs := []*Device{}
+	for dev := range ch {
+		devs = append(devs, dev)
+	}
+	sortDevices(devs)
+	return devs, nil
+}
+
+// sortDevices orders devices by name, then by identity.
+func sortDevices(devs []*Device) {
+	sort.Slice(devs, func(i, j int) bool {
+		a, b := strings.ToLower(devs[i].Name), strings.ToLower(devs[j].Name)
+		if a != b {
+			return a < b
+		}
+		return deviceKey(devs[i]) < deviceKey(devs[j])
+	})
+}
+
+// FindByName searches for the thermostat with the given name, ignoring
+// case, and returns as soon as it responds. It returns ErrNotFound if ctx
+// is done first.
+func FindByName(ctx context.Context, name string, opts ...Option) (*Device, error) {
+	d := &Discoverer{Options: opts}
+	return d.FindByName(ctx, name)
+}
+
+// FindByName searches for the thermostat with the given name, ignoring
+// case, and returns as soon as it responds.
+func (d *Discoverer) FindByName(ctx context.Context, name string) (*Device, error) {
+	return d.find(ctx, func(dev *Device) bool {
+		return strings.EqualFold(dev.Name, name)
+	})
+}
+
+// FindByMAC searches for the thermostat with the given MAC address and
+// returns as soon as it responds. It returns ErrNotFound if ctx is done
+// first.
+func FindByMAC(ctx context.Context, mac string, opts ...Option) (*Device, error) {
+	d := &Discoverer{Options: opts}
+	return d.FindByMAC(ctx, mac)
+}
+
+// FindByMAC searches for the thermostat with the given MAC address and
+// returns as soon as it responds.
+func (d *Discoverer) FindByMAC(ctx context.Context, mac string) (*Device, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return nil, err
+	}
+	return d.find(ctx, func(dev *Device) bool {
+		return bytes.Equal(dev.MAC, hw)
+	})
+}
+
+func (d *Discoverer) find(ctx context.Context, match func(*Device) bool) (*Device, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch, err := d.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for dev := range ch {
+		if match(dev) {
+			return dev, nil
+		}
+	}
+	return nil, ErrNotFound
+}
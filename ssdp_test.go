@@ -0,0 +1,168 @@
+package venstar_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func discoverAll(t *testing.T, responses ...venstartest.SSDPResponse) ([]*venstar.Device, *venstartest.SSDPResponder) {
+	t.Helper()
+	r, err := venstartest.NewSSDPResponder(responses...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	d := &venstar.Discoverer{Target: r.Addr(), Attempts: 3, Interval: 20 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	devs, err := d.DiscoverAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return devs, r
+}
+
+func TestDiscoverSkipsInvalidResponses(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithName("HALL"))
+	defer srv.Close()
+	badUSN := venstartest.VenstarResponse(srv.URL+"/", "zz:23:75:aa:bb:cc", "BAD", "residential")
+	badLocation := venstartest.VenstarResponse("ftp://127.0.0.1/", "00:23:75:aa:bb:cd", "BAD", "residential")
+	devs, _ := discoverAll(t,
+		srv.SSDPResponse("00:23:75:aa:bb:cc"),
+		venstartest.NonVenstarResponse("http://127.0.0.1:1/"),
+		venstartest.MalformedResponse(),
+		badUSN,
+		badLocation,
+	)
+	if len(devs) != 1 || devs[0].Name != "HALL" {
+		t.Fatalf("found %v, want only HALL once", devs)
+	}
+	info, err := devs[0].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "HALL" {
+		t.Errorf("Info().Name = %q, want HALL", info.Name)
+	}
+}
+
+func TestDiscoverRetransmits(t *testing.T) {
+	tests := []struct {
+		d        venstar.Discoverer
+		st       string
+		mx       string
+		searches int
+	}{
+		{venstar.Discoverer{Interval: 10 * time.Millisecond}, venstar.SearchTarget, "2", 3},
+		{venstar.Discoverer{Interval: 10 * time.Millisecond, Attempts: 5, SearchTarget: "ssdp:all", MX: 1}, "ssdp:all", "1", 5},
+	}
+	for _, tt := range tests {
+		r, err := venstartest.NewSSDPResponder()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.d.Target = r.Addr()
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		_, err = tt.d.DiscoverAll(ctx)
+		cancel()
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		searches := r.Searches()
+		if len(searches) != tt.searches {
+			t.Errorf("responder saw %d searches, want %d", len(searches), tt.searches)
+		}
+		for _, h := range searches {
+			if h.Get("ST") != tt.st || h.Get("MX") != tt.mx || h.Get("MAN") != `"ssdp:discover"` {
+				t.Errorf("search headers %v, want ST %s and MX %s", h, tt.st, tt.mx)
+			}
+			if host := h.Get("HOST"); host != r.Addr().String() {
+				t.Errorf("HOST = %s, want %s", host, r.Addr())
+			}
+		}
+	}
+}
+
+func TestDiscoverAllDedupes(t *testing.T) {
+	devs, _ := discoverAll(t,
+		venstartest.VenstarResponse("http://127.0.0.1:1/", "00:23:75:aa:bb:01", "HALL", "residential"),
+		venstartest.VenstarResponse("http://127.0.0.1:2/", "00:23:75:aa:bb:01", "HALL", "residential"),
+		venstartest.VenstarResponse("http://127.0.0.1:3/", "00:23:75:aa:bb:02", "bedroom", "residential"),
+		venstartest.VenstarResponse("http://127.0.0.1:4/", "00:23:75:aa:bb:03", "Attic", "commercial"),
+	)
+	var names []string
+	for _, dev := range devs {
+		names = append(names, dev.Name)
+	}
+	// every response arrives once per search, and HALL answers from two
+	// addresses, but each device is reported once
+	if want := []string{"Attic", "bedroom", "HALL"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("found %v, want %v", names, want)
+	}
+}
+
+func TestFindByName(t *testing.T) {
+	a := venstartest.NewServer(venstartest.WithName("HALL"))
+	defer a.Close()
+	b := venstartest.NewServer(venstartest.WithName("Bedroom"))
+	defer b.Close()
+	r, err := venstartest.NewSSDPResponder(a.SSDPResponse("00:23:75:aa:bb:01"), b.SSDPResponse("00:23:75:aa:bb:02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	d := &venstar.Discoverer{Target: r.Addr()}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	dev, err := d.FindByName(ctx, "bedroom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.URL().String() != b.URL+"/" {
+		t.Errorf("found %s, want %s/", dev.URL(), b.URL)
+	}
+	dev, err = d.FindByMAC(ctx, "00-23-75-AA-BB-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.Name != "HALL" {
+		t.Errorf("FindByMAC found %q, want HALL", dev.Name)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = d.FindByName(ctx, "attic")
+	if !errors.Is(err, venstar.ErrNotFound) {
+		t.Errorf("FindByName(attic) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDiscoverIPv6Location(t *testing.T) {
+	tests := []struct {
+		location string
+		host     string
+		port     string
+	}{
+		{"http://[fe80::1%eth0]:8080/", "fe80::1%eth0", "8080"},
+		{"http://[fe80::1%25eth0]/", "fe80::1%eth0", ""},
+		{"https://[fd00::2]:443/", "fd00::2", "443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			devs, _ := discoverAll(t, venstartest.VenstarResponse(tt.location, "00:23:75:aa:bb:cc", "HALL", "residential"))
+			if len(devs) != 1 {
+				t.Fatalf("found %d devices, want 1", len(devs))
+			}
+			u := devs[0].URL()
+			if u.Hostname() != tt.host || u.Port() != tt.port {
+				t.Errorf("URL = %s, want host %s port %q", u, tt.host, tt.port)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package venstar
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Temperature is a temperature value together with its units.
+type Temperature struct {
+	Value float64
+	Units TempUnits
+}
+
+func F(value float64) Temperature {
+	return Temperature{Value: value, Units: Fahrenheit}
+}
+
+func C(value float64) Temperature {
+	return Temperature{Value: value, Units: Celsius}
+}
+
+func (t Temperature) String() string {
+	return fmt.Sprintf("%g%s", t.Value, t.Units)
+}
+
+func (t Temperature) Fahrenheit() float64 {
+	if t.Units == Celsius {
+		return t.Value*9/5 + 32
+	}
+	return t.Value
+}
+
+func (t Temperature) Celsius() float64 {
+	if t.Units == Celsius {
+		return t.Value
+	}
+	return (t.Value - 32) * 5 / 9
+}
+
+func (t Temperature) In(units TempUnits) Temperature {
+	if units == Celsius {
+		return C(t.Celsius())
+	}
+	return F(t.Fahrenheit())
+}
+
+// Round rounds to the setpoint resolution of the thermostat, which is
+// 0.5° in Celsius and 1° in Fahrenheit.
+func (t Temperature) Round() Temperature {
+	if t.Units == Celsius {
+		t.Value = math.Round(t.Value*2) / 2
+	} else {
+		t.Value = math.Round(t.Value)
+	}
+	return t
+}
+
+// setpoint converts t to units and rounds it for sending to the device.
+func (t Temperature) setpoint(units TempUnits) float64 {
+	return t.In(units).Round().Value
+}
+
+func (info *DeviceInfo) SpaceTemperature() Temperature {
+	return Temperature{Value: info.SpaceTemp, Units: info.TempUnits}
+}
+
+func (info *DeviceInfo) HeatTemperature() Temperature {
+	return Temperature{Value: info.HeatTemp, Units: info.TempUnits}
+}
+
+func (info *DeviceInfo) CoolTemperature() Temperature {
+	return Temperature{Value: info.CoolTemp, Units: info.TempUnits}
+}
+
+// Temperature returns the sensor reading. Sensors report in the units
+// the thermostat is set to, which must be passed in.
+func (info *SensorInfo) Temperature(units TempUnits) Temperature {
+	return Temperature{Value: info.Temp, Units: units}
+}
+
+func (dev *Device) SetHeatTemperature(temp Temperature) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetHeatTemperatureContext(ctx, temp)
+}
+
+func (dev *Device) SetHeatTemperatureContext(ctx context.Context, temp Temperature) error {
+	return dev.UpdateContext(ctx, func(c *ControlMessage, s *SettingsMessage) error {
+		*c = c.withHeatSetpoint(temp.setpoint(s.TempUnits))
+		return nil
+	})
+}
+
+func (dev *Device) SetCoolTemperature(temp Temperature) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetCoolTemperatureContext(ctx, temp)
+}
+
+func (dev *Device) SetCoolTemperatureContext(ctx context.Context, temp Temperature) error {
+	return dev.UpdateContext(ctx, func(c *ControlMessage, s *SettingsMessage) error {
+		*c = c.withCoolSetpoint(temp.setpoint(s.TempUnits))
+		return nil
+	})
+}
+
+func (dev *Device) SetHeatCoolTemperatures(heat, cool Temperature) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	return dev.SetHeatCoolTemperaturesContext(ctx, heat, cool)
+}
+
+func (dev *Device) SetHeatCoolTemperaturesContext(ctx context.Context, heat, cool Temperature) error {
+	return dev.UpdateContext(ctx, func(c *ControlMessage, s *SettingsMessage) error {
+		*c = c.withHeatCoolSetpoints(heat.setpoint(s.TempUnits), cool.setpoint(s.TempUnits))
+		return nil
+	})
+}
@@ -0,0 +1,78 @@
+package venstar_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestTemperatureConversion(t *testing.T) {
+	tests := []struct {
+		temp    venstar.Temperature
+		units   venstar.TempUnits
+		exact   float64
+		rounded float64
+	}{
+		{venstar.F(70), venstar.Celsius, 21.111, 21},
+		{venstar.F(71), venstar.Celsius, 21.667, 21.5},
+		{venstar.F(73), venstar.Celsius, 22.778, 23},
+		{venstar.F(32), venstar.Celsius, 0, 0},
+		{venstar.C(21.5), venstar.Fahrenheit, 70.7, 71},
+		{venstar.C(20), venstar.Fahrenheit, 68, 68},
+		{venstar.C(-40), venstar.Fahrenheit, -40, -40},
+		{venstar.F(68.4), venstar.Fahrenheit, 68.4, 68},
+	}
+	for _, tt := range tests {
+		got := tt.temp.In(tt.units)
+		if got.Units != tt.units || math.Abs(got.Value-tt.exact) > 0.001 {
+			t.Errorf("%s.In(%s) = %s, want %g%s", tt.temp, tt.units, got, tt.exact, tt.units)
+		}
+		if r := got.Round(); r.Value != tt.rounded {
+			t.Errorf("%s.In(%s).Round() = %s, want %g%s", tt.temp, tt.units, r, tt.rounded, tt.units)
+		}
+	}
+}
+
+func TestSetTemperatureConverts(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dev.SetCoolTemperature(venstar.C(24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cool := srv.Info().CoolTemp; cool != 75 {
+		t.Errorf("CoolTemp = %g°F, want 24°C rounded to 75°F", cool)
+	}
+
+	err = dev.SetTempUnits(venstar.Celsius)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dev.SetHeatTemperature(venstar.F(70))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heat := srv.Info().HeatTemp; heat != 21 {
+		t.Errorf("HeatTemp = %g°C, want 70°F rounded to 21°C", heat)
+	}
+	err = dev.SetHeatCoolTemperatures(venstar.F(71), venstar.C(24.3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := dev.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if heat := info.HeatTemperature(); heat != venstar.C(21.5) {
+		t.Errorf("HeatTemperature() = %s, want 21.5C", heat)
+	}
+	if cool := info.CoolTemperature(); cool != venstar.C(24.5) {
+		t.Errorf("CoolTemperature() = %s, want 24.5C", cool)
+	}
+}
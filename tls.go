@@ -0,0 +1,78 @@
+package venstar
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+func normalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ReplaceAll(fingerprint, ":", "")
+	return strings.ToLower(strings.TrimSpace(fingerprint))
+}
+
+// CertificateFingerprint returns the pinned SHA-256 fingerprint of the
+// device certificate, which is the one learned on first use when trust on
+// first use is enabled.
+func (dev *Device) CertificateFingerprint() string {
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+	return dev.fingerprint
+}
+
+func (dev *Device) configureTLS() {
+	if dev.fingerprint == "" && !dev.trustOnFirstUse {
+		return
+	}
+	var transport *http.Transport
+	switch rt := dev.client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = rt.Clone()
+	default:
+		// a custom RoundTripper is responsible for its own TLS config
+		return
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	// Thermostats use self-signed certificates, so chain verification is
+	// replaced by checking the certificate fingerprint against the pin.
+	transport.TLSClientConfig.InsecureSkipVerify = true
+	transport.TLSClientConfig.VerifyConnection = dev.verifyConnection
+	dev.client.Transport = transport
+}
+
+func (dev *Device) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("device presented no certificate")
+	}
+	sum := sha256.Sum256(cs.PeerCertificates[0].Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	dev.mu.Lock()
+	pinned := dev.fingerprint
+	dev.mu.Unlock()
+	if pinned == "" {
+		// the callback runs unlocked so it may use the device
+		if dev.onFirstUse != nil {
+			err := dev.onFirstUse(fingerprint)
+			if err != nil {
+				return err
+			}
+		}
+		dev.mu.Lock()
+		if dev.fingerprint == "" {
+			dev.fingerprint = fingerprint
+		}
+		pinned = dev.fingerprint
+		dev.mu.Unlock()
+	}
+	if pinned != fingerprint {
+		return &CertificateError{Fingerprint: fingerprint, Pinned: pinned}
+	}
+	return nil
+}
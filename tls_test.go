@@ -0,0 +1,120 @@
+package venstar_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestTrustOnFirstUse(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithTLS(), venstartest.WithName("HALL"))
+	defer srv.Close()
+	r, err := venstartest.NewSSDPResponder(srv.SSDPResponse("00:23:75:aa:bb:cc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var dev *venstar.Device
+	var stored string
+	// the store callback may use the device without deadlocking
+	store := func(fingerprint string) error {
+		stored = fingerprint
+		if pinned := dev.CertificateFingerprint(); pinned != "" {
+			t.Errorf("fingerprint pinned before store returned: %s", pinned)
+		}
+		return nil
+	}
+	d := &venstar.Discoverer{Target: r.Addr(), Options: []venstar.Option{venstar.WithTrustOnFirstUse(store)}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	dev, err = d.FindByName(ctx, "HALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dev.InfoContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == "" || dev.CertificateFingerprint() != stored {
+		t.Fatalf("stored %q, pinned %q", stored, dev.CertificateFingerprint())
+	}
+
+	pinned, err := venstar.Open(srv.URL, venstar.WithCertificatePin(stored))
+	if err != nil {
+		t.Fatalf("Open with learned pin: %v", err)
+	}
+	if pinned.Name != "HALL" {
+		t.Errorf("Name = %q, want HALL", pinned.Name)
+	}
+	_, err = venstar.Open(srv.URL, venstar.WithCertificatePin(strings.Repeat("00", 32)))
+	var certErr *venstar.CertificateError
+	if !errors.As(err, &certErr) {
+		t.Errorf("Open with wrong pin = %v, want *CertificateError", err)
+	}
+	if errors.Is(err, venstar.ErrUnreachable) {
+		t.Errorf("certificate mismatch reported as unreachable: %v", err)
+	}
+}
+
+func TestUpgradeToHTTPS(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithTLS(), venstartest.WithName("HALL"))
+	defer srv.Close()
+	plain := strings.Replace(srv.URL, "https://", "http://", 1)
+	dev, err := venstar.Open(plain, venstar.WithTrustOnFirstUse(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.URL().Scheme != "https" {
+		t.Errorf("URL = %s, want https", dev.URL())
+	}
+}
+
+func TestNoUpgradeAfterDroppedWrite(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	// a proxy that drops the connection after reading a write, so the
+	// device may already have applied it
+	var conns, requests atomic.Int32
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Method != http.MethodPost {
+			srv.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	proxy.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	proxy.Start()
+	defer proxy.Close()
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	dev, err := venstar.Open(proxy.URL, venstar.WithHTTPClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dev.SetFanMode(venstar.FanSettingOn)
+	if !errors.Is(err, venstar.ErrUnreachable) {
+		t.Errorf("SetFanMode = %v, want ErrUnreachable", err)
+	}
+	if c, r := conns.Load(), requests.Load(); c != r {
+		t.Errorf("%d connections for %d requests, want no https retry", c, r)
+	}
+	if dev.URL().Scheme != "http" {
+		t.Errorf("URL = %s, want http", dev.URL())
+	}
+}
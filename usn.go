@@ -0,0 +1,58 @@
+package venstar
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// usn is the identity a thermostat advertises in its SSDP USN header,
+// ecp:00:23:75:xx:xx:xx:name:NAME:type:TYPE.
+type usn struct {
+	mac    net.HardwareAddr
+	name   string
+	typ    DeviceType
+	fields map[string]string
+}
+
+// parseUSN splits a USN into its MAC address and key/value segments.
+// Values are percent-decoded. Since names may contain unescaped colons,
+// the name runs up to the next type segment rather than the next colon.
+func parseUSN(s string) (*usn, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 7 || !strings.EqualFold(parts[0], "ecp") {
+		return nil, &ResponseError{Header: "USN", Value: s, Reason: "expected ecp:MAC prefix"}
+	}
+	mac, err := net.ParseMAC(strings.Join(parts[1:7], ":"))
+	if err != nil {
+		return nil, &ResponseError{Header: "USN", Value: s, Reason: "invalid mac address", Err: err}
+	}
+	id := &usn{mac: mac, fields: map[string]string{}}
+	rest := parts[7:]
+	for len(rest) > 0 {
+		key := strings.ToLower(rest[0])
+		if len(rest) < 2 {
+			return nil, &ResponseError{Header: "USN", Value: s, Reason: "missing value for " + key}
+		}
+		n := 2
+		if key == "name" {
+			for n < len(rest) && !strings.EqualFold(rest[n], "type") {
+				n++
+			}
+		}
+		value, err := url.PathUnescape(strings.Join(rest[1:n], ":"))
+		if err != nil {
+			return nil, &ResponseError{Header: "USN", Value: s, Reason: "invalid " + key, Err: err}
+		}
+		switch key {
+		case "name":
+			id.name = value
+		case "type":
+			id.typ = DeviceType(strings.ToLower(value))
+		default:
+			id.fields[key] = value
+		}
+		rest = rest[n:]
+	}
+	return id, nil
+}
@@ -0,0 +1,66 @@
+package venstar_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestDiscoverUSN(t *testing.T) {
+	tests := []struct {
+		usn    string
+		name   string
+		typ    venstar.DeviceType
+		fields map[string]string
+	}{
+		{"ecp:00:23:75:aa:bb:cc:name:HALL:type:residential", "HALL", venstar.DeviceTypeResidential, nil},
+		{"ecp:00:23:75:aa:bb:cc:name:Up:stairs:type:commercial", "Up:stairs", venstar.DeviceTypeCommercial, nil},
+		{"ecp:00:23:75:aa:bb:cc:name:Living%20Room%3A1:type:residential", "Living Room:1", venstar.DeviceTypeResidential, nil},
+		{"ecp:00:23:75:AA:BB:CC:name:HALL:type:Residential:zone:2", "HALL", venstar.DeviceTypeResidential, map[string]string{"zone": "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.usn, func(t *testing.T) {
+			resp := venstartest.VenstarResponse("http://127.0.0.1:1/", "", "", "")
+			resp.USN = tt.usn
+			devs, _ := discoverAll(t, resp)
+			if len(devs) != 1 {
+				t.Fatalf("found %d devices, want 1", len(devs))
+			}
+			dev := devs[0]
+			if dev.Name != tt.name {
+				t.Errorf("Name = %q, want %q", dev.Name, tt.name)
+			}
+			if dev.MAC.String() != "00:23:75:aa:bb:cc" {
+				t.Errorf("MAC = %s, want 00:23:75:aa:bb:cc", dev.MAC)
+			}
+			if dev.Type != tt.typ {
+				t.Errorf("Type = %q, want %q", dev.Type, tt.typ)
+			}
+			for k, v := range tt.fields {
+				if dev.Fields[k] != v {
+					t.Errorf("Fields[%q] = %q, want %q", k, dev.Fields[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestNewDeviceInvalidUSN(t *testing.T) {
+	for _, usn := range []string{
+		"uuid:2f402f80-da50-11e1-9b23-001788255acc",
+		"ecp:00:23:75:aa:bb",
+		"ecp:00:23:75:aa:bb:zz:name:HALL:type:residential",
+		"ecp:00:23:75:aa:bb:cc:name:HALL:type",
+		"ecp:00:23:75:aa:bb:cc:name:HALL%zz:type:residential",
+	} {
+		msg := fmt.Sprintf("HTTP/1.1 200 OK\r\nST: %s\r\nLocation: http://127.0.0.1/\r\nUSN: %s\r\n\r\n", venstar.SearchTarget, usn)
+		dev, err := venstar.NewDevice([]byte(msg))
+		var rerr *venstar.ResponseError
+		if !errors.As(err, &rerr) || rerr.Header != "USN" || rerr.Value != usn {
+			t.Errorf("NewDevice with USN %s = %v, %v; want *ResponseError for the USN", usn, dev, err)
+		}
+	}
+}
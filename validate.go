@@ -0,0 +1,111 @@
+package venstar
+
+import (
+	"fmt"
+	"math"
+)
+
+type setpointLimits struct {
+	heatMin float64
+	heatMax float64
+	coolMin float64
+	coolMax float64
+	delta   float64
+}
+
+// limits returns the setpoint limits reported by the device, falling back
+// to the firmware defaults for the current units for any it left out.
+func (info *DeviceInfo) limits() setpointLimits {
+	lim := setpointLimits{heatMin: 35, heatMax: 99, coolMin: 35, coolMax: 99, delta: 2}
+	if info.TempUnits == Celsius {
+		lim = setpointLimits{heatMin: 2, heatMax: 37, coolMin: 2, coolMax: 37, delta: 1}
+	}
+	if info.HeatTempMin != 0 || info.HeatTempMax != 0 {
+		lim.heatMin, lim.heatMax = info.HeatTempMin, info.HeatTempMax
+	}
+	if info.CoolTempMin != 0 || info.CoolTempMax != 0 {
+		lim.coolMin, lim.coolMax = info.CoolTempMin, info.CoolTempMax
+	}
+	if info.SetPointDelta != 0 {
+		lim.delta = info.SetPointDelta
+	}
+	return lim
+}
+
+// ValidateFor checks the setpoints against the limits and deadband
+// reported by the device in info.
+func (msg ControlMessage) ValidateFor(info *DeviceInfo) error {
+	lim := info.limits()
+	if msg.HeatTemp < lim.heatMin || msg.HeatTemp > lim.heatMax {
+		return &ValidationError{Field: "heattemp", Value: msg.HeatTemp, Min: lim.heatMin, Max: lim.heatMax}
+	}
+	if msg.CoolTemp < lim.coolMin || msg.CoolTemp > lim.coolMax {
+		return &ValidationError{Field: "cooltemp", Value: msg.CoolTemp, Min: lim.coolMin, Max: lim.coolMax}
+	}
+	if msg.CoolTemp-msg.HeatTemp < lim.delta {
+		return &ValidationError{
+			Field:  "cooltemp",
+			Value:  msg.CoolTemp,
+			Min:    msg.HeatTemp + lim.delta,
+			Max:    math.NaN(),
+			Reason: fmt.Sprintf("difference between heat & cool temps (%g) less than %g%s", msg.CoolTemp-msg.HeatTemp, lim.delta, info.TempUnits),
+		}
+	}
+	return nil
+}
+
+// Adjustment records a setpoint changed by Clamp.
+type Adjustment struct {
+	Field string
+	From  float64
+	To    float64
+}
+
+func (adj Adjustment) String() string {
+	return fmt.Sprintf("%s %g -> %g", adj.Field, adj.From, adj.To)
+}
+
+// Clamp moves the setpoints to the nearest values that pass ValidateFor.
+// When the deadband is violated the setpoint that matters less for the
+// current mode is the one that moves.
+func (msg ControlMessage) Clamp(info *DeviceInfo) (ControlMessage, []Adjustment) {
+	lim := info.limits()
+	heat := math.Min(math.Max(msg.HeatTemp, lim.heatMin), lim.heatMax)
+	cool := math.Min(math.Max(msg.CoolTemp, lim.coolMin), lim.coolMax)
+	if cool-heat < lim.delta {
+		if msg.Mode == ModeCool {
+			heat = cool - lim.delta
+		} else {
+			cool = heat + lim.delta
+		}
+		if cool > lim.coolMax {
+			cool = lim.coolMax
+			heat = cool - lim.delta
+		}
+		if heat < lim.heatMin {
+			heat = lim.heatMin
+			cool = math.Max(cool, heat+lim.delta)
+		}
+	}
+	var adjs []Adjustment
+	if heat != msg.HeatTemp {
+		adjs = append(adjs, Adjustment{Field: "heattemp", From: msg.HeatTemp, To: heat})
+	}
+	if cool != msg.CoolTemp {
+		adjs = append(adjs, Adjustment{Field: "cooltemp", From: msg.CoolTemp, To: cool})
+	}
+	msg.HeatTemp = heat
+	msg.CoolTemp = cool
+	return msg, adjs
+}
+
+func (dev *Device) checkControl(info *DeviceInfo, msg ControlMessage) (ControlMessage, error) {
+	if dev.clamp {
+		var adjs []Adjustment
+		msg, adjs = msg.Clamp(info)
+		if len(adjs) > 0 && dev.onClamp != nil {
+			dev.onClamp(adjs)
+		}
+	}
+	return msg, msg.ValidateFor(info)
+}
@@ -0,0 +1,91 @@
+package venstar_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestClamp(t *testing.T) {
+	info := &venstar.DeviceInfo{
+		TempUnits:     venstar.Fahrenheit,
+		HeatTempMin:   40,
+		HeatTempMax:   90,
+		CoolTempMin:   45,
+		CoolTempMax:   95,
+		SetPointDelta: 3,
+	}
+	tests := []struct {
+		name       string
+		msg        venstar.ControlMessage
+		heat, cool float64
+		adjusted   []string
+	}{
+		{"in range", venstar.ControlMessage{Mode: venstar.ModeAuto, HeatTemp: 68, CoolTemp: 74}, 68, 74, nil},
+		{"heat too low", venstar.ControlMessage{Mode: venstar.ModeHeat, HeatTemp: 30, CoolTemp: 74}, 40, 74, []string{"heattemp"}},
+		{"cool too high", venstar.ControlMessage{Mode: venstar.ModeCool, HeatTemp: 68, CoolTemp: 100}, 68, 95, []string{"cooltemp"}},
+		{"deadband heating", venstar.ControlMessage{Mode: venstar.ModeHeat, HeatTemp: 72, CoolTemp: 73}, 72, 75, []string{"cooltemp"}},
+		{"deadband cooling", venstar.ControlMessage{Mode: venstar.ModeCool, HeatTemp: 72, CoolTemp: 73}, 70, 73, []string{"heattemp"}},
+		{"deadband at max", venstar.ControlMessage{Mode: venstar.ModeHeat, HeatTemp: 90, CoolTemp: 90}, 90, 93, []string{"cooltemp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, adjs := tt.msg.Clamp(info)
+			if got.HeatTemp != tt.heat || got.CoolTemp != tt.cool {
+				t.Errorf("Clamp = %g/%g, want %g/%g", got.HeatTemp, got.CoolTemp, tt.heat, tt.cool)
+			}
+			var fields []string
+			for _, adj := range adjs {
+				fields = append(fields, adj.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.adjusted) {
+				t.Errorf("adjusted %v, want %v", fields, tt.adjusted)
+			}
+			if err := got.ValidateFor(info); err != nil {
+				t.Errorf("clamped message fails validation: %v", err)
+			}
+		})
+	}
+}
+
+func TestSetpointValidationAgainstDevice(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dev.SetHeatCoolTemps(70, 71)
+	var verr *venstar.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("SetHeatCoolTemps(70, 71) = %v, want *ValidationError", err)
+	}
+	if info := srv.Info(); info.HeatTemp != 68 || info.CoolTemp != 76 {
+		t.Errorf("invalid setpoints were written: %g/%g", info.HeatTemp, info.CoolTemp)
+	}
+}
+
+func TestSetpointClampingAgainstDevice(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	var reported []venstar.Adjustment
+	dev, err := venstar.Open(srv.URL, venstar.WithClamping(func(adjs []venstar.Adjustment) {
+		reported = append(reported, adjs...)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dev.SetHeatCoolTemps(20, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := srv.Info(); info.HeatTemp != 35 || info.CoolTemp != 99 {
+		t.Errorf("setpoints = %g/%g, want 35/99", info.HeatTemp, info.CoolTemp)
+	}
+	if len(reported) != 2 {
+		t.Errorf("reported %v, want two adjustments", reported)
+	}
+}
@@ -0,0 +1,79 @@
+package venstartest
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type authenticator struct {
+	scheme   string
+	username string
+	password string
+	nonce    string
+}
+
+const realm = "venstar"
+
+func newNonce() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func md5hex(parts ...string) string {
+	h := md5.New()
+	io.WriteString(h, strings.Join(parts, ":"))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// check verifies the request credentials, writing a 401 challenge and
+// returning false if they are missing or wrong.
+func (a *authenticator) check(w http.ResponseWriter, r *http.Request) bool {
+	switch a.scheme {
+	case "basic":
+		username, password, ok := r.BasicAuth()
+		if ok && subtle.ConstantTimeCompare([]byte(username), []byte(a.username)) == 1 && subtle.ConstantTimeCompare([]byte(password), []byte(a.password)) == 1 {
+			return true
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+	case "digest":
+		if a.checkDigest(r) {
+			return true
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Digest realm=%q, qop=\"auth\", nonce=%q, algorithm=MD5", realm, a.nonce))
+	}
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	return false
+}
+
+func (a *authenticator) checkDigest(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Digest ") {
+		return false
+	}
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(header, "Digest "), ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[key] = strings.Trim(val, `"`)
+		}
+	}
+	if params["username"] != a.username || params["nonce"] != a.nonce || params["uri"] != r.URL.RequestURI() {
+		return false
+	}
+	ha1 := md5hex(a.username, realm, a.password)
+	ha2 := md5hex(r.Method, params["uri"])
+	var expected string
+	if params["qop"] == "auth" {
+		expected = md5hex(ha1, a.nonce, params["nc"], params["cnonce"], "auth", ha2)
+	} else {
+		expected = md5hex(ha1, a.nonce, ha2)
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(params["response"])) == 1
+}
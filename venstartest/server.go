@@ -0,0 +1,641 @@
+// Package venstartest provides an in-process fake Venstar thermostat for
+// testing code that uses venstar.Device.
+package venstartest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclancey/venstar"
+)
+
+type Option func(*Server)
+
+func WithName(name string) Option {
+	return func(s *Server) {
+		s.info.Name = name
+	}
+}
+
+func WithModel(model string) Option {
+	return func(s *Server) {
+		s.caps.Model = model
+	}
+}
+
+func WithAPIVersion(version int) Option {
+	return func(s *Server) {
+		s.caps.APIVersion = version
+	}
+}
+
+func WithFirmware(firmware string) Option {
+	return func(s *Server) {
+		s.caps.Firmware = firmware
+	}
+}
+
+func WithType(typ venstar.DeviceType) Option {
+	return func(s *Server) {
+		s.caps.Type = typ
+	}
+}
+
+// WithInfo replaces the initial thermostat state.
+func WithInfo(info venstar.DeviceInfo) Option {
+	return func(s *Server) {
+		s.info = info
+	}
+}
+
+// WithPIN makes the fake reject control and settings writes that do not
+// carry pin.
+func WithPIN(pin string) Option {
+	return func(s *Server) {
+		s.pin = pin
+	}
+}
+
+func WithBasicAuth(username, password string) Option {
+	return func(s *Server) {
+		s.auth = &authenticator{scheme: "basic", username: username, password: password}
+	}
+}
+
+func WithDigestAuth(username, password string) Option {
+	return func(s *Server) {
+		s.auth = &authenticator{scheme: "digest", username: username, password: password, nonce: newNonce()}
+	}
+}
+
+// WithTLS serves https with a self-signed certificate instead of http.
+func WithTLS() Option {
+	return func(s *Server) {
+		s.tls = true
+	}
+}
+
+// Server is a fake thermostat implementing the local API endpoints with
+// the same validation and error responses as the real firmware.
+type Server struct {
+	*httptest.Server
+	mu        sync.Mutex
+	caps      venstar.Capabilities
+	info      venstar.DeviceInfo
+	sensors   []*venstar.SensorInfo
+	alerts    []*venstar.AlertInfo
+	runtimes  []*venstar.RuntimeInfo
+	pin       string
+	auth      *authenticator
+	tls       bool
+	latency   time.Duration
+	errors    map[string]int
+	malformed map[string]bool
+	requests  []string
+	forms     map[string][]url.Values
+	dropped   map[string]int
+}
+
+// NewServer starts a fake residential ColorTouch thermostat. The caller
+// should call Close when done.
+func NewServer(opts ...Option) *Server {
+	s := &Server{
+		caps: venstar.Capabilities{
+			APIVersion: 7,
+			Type:       venstar.DeviceTypeResidential,
+			Model:      "COLORTOUCH",
+			Firmware:   "6.93",
+		},
+		info: venstar.DeviceInfo{
+			Name:               "THERMOSTAT",
+			Mode:               venstar.ModeAuto,
+			TempUnits:          venstar.Fahrenheit,
+			SchedulePart:       venstar.SchedulePartInactive,
+			SpaceTemp:          71,
+			HeatTemp:           68,
+			CoolTemp:           76,
+			CoolTempMin:        35,
+			CoolTempMax:        99,
+			HeatTempMin:        35,
+			HeatTempMax:        99,
+			SetPointDelta:      2,
+			Humidity:           40,
+			HumidifySetpoint:   30,
+			DehumidifySetpoint: 60,
+		},
+		alerts: []*venstar.AlertInfo{
+			{Name: "Air Filter"},
+			{Name: "indoorHi"},
+			{Name: "indoorLo"},
+			{Name: "supplyHt"},
+			{Name: "supplyCl"},
+			{Name: "dryCtct"},
+			{Name: "dayHeat"},
+			{Name: "dayCool"},
+			{Name: "filterHr"},
+			{Name: "filter"},
+			{Name: "service"},
+		},
+		errors:    map[string]int{},
+		malformed: map[string]bool{},
+		forms:     map[string][]url.Values{},
+		dropped:   map[string]int{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.sensors == nil {
+		s.sensors = []*venstar.SensorInfo{
+			{Name: "Thermostat", Temp: s.info.SpaceTemp, Humidity: s.info.Humidity},
+			{Name: "Space Temp", Temp: s.info.SpaceTemp},
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleRoot)
+	mux.HandleFunc("/query/info", s.handleInfo)
+	mux.HandleFunc("/query/sensors", s.handleSensors)
+	mux.HandleFunc("/query/alerts", s.handleAlerts)
+	mux.HandleFunc("/query/runtimes", s.handleRuntimes)
+	mux.HandleFunc("/control", s.handleControl)
+	mux.HandleFunc("/settings", s.handleSettings)
+	handler := s.middleware(mux)
+	if s.tls {
+		s.Server = httptest.NewTLSServer(handler)
+	} else {
+		s.Server = httptest.NewServer(handler)
+	}
+	return s
+}
+
+// Info returns a copy of the current thermostat state.
+func (s *Server) Info() venstar.DeviceInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info
+}
+
+// Update lets fn modify the thermostat state.
+func (s *Server) Update(fn func(info *venstar.DeviceInfo)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.info)
+}
+
+func (s *Server) SetSensors(sensors []*venstar.SensorInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sensors = sensors
+}
+
+func (s *Server) SetAlert(name string, active bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, alert := range s.alerts {
+		if alert.Name == name {
+			alert.Active = active
+			return
+		}
+	}
+	s.alerts = append(s.alerts, &venstar.AlertInfo{Name: name, Active: active})
+}
+
+func (s *Server) SetRuntimes(runtimes []*venstar.RuntimeInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runtimes = runtimes
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// SetHTTPError makes requests to path fail with status until
+// ClearFaults is called.
+func (s *Server) SetHTTPError(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[path] = status
+}
+
+// SetMalformed makes requests to path return truncated JSON until
+// ClearFaults is called.
+func (s *Server) SetMalformed(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.malformed[path] = true
+}
+
+// DropWrites makes the next n writes to path report success without
+// being applied, like a thermostat busy with its own schedule change. A
+// negative n drops every write until ClearFaults is called.
+func (s *Server) DropWrites(path string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped[path] = n
+}
+
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = 0
+	s.errors = map[string]int{}
+	s.malformed = map[string]bool{}
+	s.dropped = map[string]int{}
+}
+
+// apply stores info as the new state unless the write to path is to be
+// dropped.
+func (s *Server) apply(path string, info venstar.DeviceInfo) {
+	if n := s.dropped[path]; n != 0 {
+		if n > 0 {
+			s.dropped[path] = n - 1
+		}
+		return
+	}
+	s.info = info
+}
+
+// Requests returns the method and path of every request served so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Forms returns the form of every POST to path served so far, including
+// any pin sent.
+func (s *Server) Forms(path string) []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.forms[path]...)
+}
+
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		latency := s.latency
+		status := s.errors[r.URL.Path]
+		malformed := s.malformed[r.URL.Path]
+		auth := s.auth
+		s.mu.Unlock()
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if auth != nil && !auth.check(w, r) {
+			return
+		}
+		if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		if malformed {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"name":"THERM`)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeStatus(w http.ResponseWriter, reason string) {
+	if reason == "" {
+		writeJSON(w, map[string]bool{"success": true})
+		return
+	}
+	writeJSON(w, map[string]any{"error": true, "reason": reason})
+}
+
+// firmwareJSON encodes v the way the firmware does, with enums as
+// integers rather than the names venstar types marshal to.
+func firmwareJSON(v any) map[string]any {
+	rv := reflect.ValueOf(v)
+	rt := rv.Type()
+	out := map[string]any{}
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if sf.PkgPath != "" || name == "" || name == "-" {
+			continue
+		}
+		field := rv.Field(i)
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			out[name] = field.Int()
+		case reflect.Float32, reflect.Float64:
+			out[name] = field.Float()
+		default:
+			out[name] = field.Interface()
+		}
+	}
+	if extra, ok := rv.FieldByName("Extra").Interface().(map[string]json.RawMessage); ok {
+		for key, val := range extra {
+			out[key] = val
+		}
+	}
+	return out
+}
+
+func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, map[string]any{
+		"api_ver":  s.caps.APIVersion,
+		"type":     s.caps.Type,
+		"model":    s.caps.Model,
+		"firmware": s.caps.Firmware,
+	})
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, firmwareJSON(s.info))
+}
+
+func (s *Server) handleSensors(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sensors := make([]map[string]any, len(s.sensors))
+	for i, sensor := range s.sensors {
+		sensors[i] = firmwareJSON(*sensor)
+	}
+	writeJSON(w, map[string]any{"sensors": sensors})
+}
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, venstar.AlertsResponse{Alerts: s.alerts})
+}
+
+func (s *Server) handleRuntimes(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runtimes := s.runtimes
+	if runtimes == nil {
+		runtimes = []*venstar.RuntimeInfo{}
+	}
+	writeJSON(w, venstar.RuntimesResponse{Runtimes: runtimes})
+}
+
+// parseWrite parses a control or settings POST and checks the PIN,
+// returning a rejection reason if the write should fail.
+func (s *Server) parseWrite(r *http.Request) string {
+	if r.Method != http.MethodPost {
+		return "POST required"
+	}
+	err := r.ParseForm()
+	if err != nil {
+		return "Malformed request"
+	}
+	s.forms[r.URL.Path] = append(s.forms[r.URL.Path], r.PostForm)
+	if s.pin != "" {
+		pin := r.PostForm.Get("pin")
+		if pin == "" {
+			return "PIN required"
+		}
+		if pin != s.pin {
+			return "Incorrect PIN"
+		}
+	}
+	return ""
+}
+
+func formInt(form map[string][]string, key string, min, max int) (int, bool, string) {
+	vals, ok := form[key]
+	if !ok || len(vals) == 0 {
+		return 0, false, ""
+	}
+	n, err := strconv.Atoi(vals[0])
+	if err != nil || n < min || n > max {
+		return 0, true, "Invalid " + key
+	}
+	return n, true, ""
+}
+
+func formFloat(form map[string][]string, key string) (float64, bool, string) {
+	vals, ok := form[key]
+	if !ok || len(vals) == 0 {
+		return 0, false, ""
+	}
+	f, err := strconv.ParseFloat(vals[0], 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, true, "Invalid " + key
+	}
+	return f, true, ""
+}
+
+func (s *Server) handleControl(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reason := s.parseWrite(r); reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	form := r.PostForm
+	info := s.info
+	mode, ok, reason := formInt(form, "mode", 0, 3)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok {
+		info.Mode = venstar.ThermostatMode(mode)
+	}
+	fan, ok, reason := formInt(form, "fan", 0, 1)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok {
+		info.FanSetting = venstar.FanSetting(fan)
+	}
+	heat, hasHeat, reason := formFloat(form, "heattemp")
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	cool, hasCool, reason := formFloat(form, "cooltemp")
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if hasHeat != hasCool {
+		writeStatus(w, "heattemp and cooltemp must be set together")
+		return
+	}
+	if hasHeat {
+		if heat < info.HeatTempMin || heat > info.HeatTempMax {
+			writeStatus(w, "heattemp out of range")
+			return
+		}
+		if cool < info.CoolTempMin || cool > info.CoolTempMax {
+			writeStatus(w, "cooltemp out of range")
+			return
+		}
+		if cool-heat < info.SetPointDelta {
+			writeStatus(w, fmt.Sprintf("cooltemp must be at least %g degrees above heattemp", info.SetPointDelta))
+			return
+		}
+		info.HeatTemp = heat
+		info.CoolTemp = cool
+	}
+	s.apply(r.URL.Path, info)
+	writeStatus(w, "")
+}
+
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reason := s.parseWrite(r); reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	info := s.info
+	residential := strings.EqualFold(string(s.caps.Type), string(venstar.DeviceTypeResidential))
+	humidity := strings.Contains(strings.ToUpper(s.caps.Model), "COLORTOUCH")
+	// Like the firmware, settings the model does not support are
+	// silently ignored rather than rejected.
+	form := url.Values{}
+	for key, vals := range r.PostForm {
+		switch key {
+		case "away":
+			if !residential {
+				continue
+			}
+		case "holiday", "override", "overridetime", "forceunocc":
+			if residential {
+				continue
+			}
+		case "hum_setpoint", "dehum_setpoint":
+			if !humidity {
+				continue
+			}
+		}
+		form[key] = vals
+	}
+	units, ok, reason := formInt(form, "tempunits", 0, 1)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok && venstar.TempUnits(units) != info.TempUnits {
+		convertUnits(&info, venstar.TempUnits(units))
+	}
+	sched, ok, reason := formInt(form, "schedule", 0, 1)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok {
+		info.Schedule = venstar.ScheduleState(sched)
+	}
+	away, ok, reason := formInt(form, "away", 0, 1)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok {
+		info.Away = venstar.AwayState(away)
+	}
+	holiday, ok, reason := formInt(form, "holiday", 0, 1)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok {
+		info.Holiday = venstar.HolidayState(holiday)
+	}
+	override, ok, reason := formInt(form, "override", 0, 1)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok {
+		info.Override = venstar.OverrideState(override)
+	}
+	overrideTime, ok, reason := formInt(form, "overridetime", 0, 24*60)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok {
+		info.OverrideTime = overrideTime
+	}
+	if info.Override == venstar.OverrideStateOff {
+		info.OverrideTime = 0
+	}
+	forceUnocc, ok, reason := formInt(form, "forceunocc", 0, 1)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok {
+		info.ForceUnocc = venstar.ForceUnoccState(forceUnocc)
+	}
+	hum, ok, reason := formInt(form, "hum_setpoint", 0, 60)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok {
+		info.HumidifySetpoint = float64(hum)
+	}
+	dehum, ok, reason := formInt(form, "dehum_setpoint", 25, 99)
+	if reason != "" {
+		writeStatus(w, reason)
+		return
+	}
+	if ok {
+		info.DehumidifySetpoint = float64(dehum)
+	}
+	s.apply(r.URL.Path, info)
+	writeStatus(w, "")
+}
+
+// convertUnits switches the thermostat units, converting every
+// temperature it reports the way the firmware does.
+func convertUnits(info *venstar.DeviceInfo, units venstar.TempUnits) {
+	conv := func(v float64) float64 {
+		return venstar.Temperature{Value: v, Units: info.TempUnits}.In(units).Round().Value
+	}
+	info.SpaceTemp = conv(info.SpaceTemp)
+	info.HeatTemp = conv(info.HeatTemp)
+	info.CoolTemp = conv(info.CoolTemp)
+	info.HeatTempMin = conv(info.HeatTempMin)
+	info.HeatTempMax = conv(info.HeatTempMax)
+	info.CoolTempMin = conv(info.CoolTempMin)
+	info.CoolTempMax = conv(info.CoolTempMax)
+	if units == venstar.Celsius {
+		info.SetPointDelta = math.Round(info.SetPointDelta*5/9*2) / 2
+	} else {
+		info.SetPointDelta = math.Round(info.SetPointDelta * 9 / 5)
+	}
+	info.TempUnits = units
+}
@@ -0,0 +1,328 @@
+package venstartest
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rclancey/venstar"
+)
+
+// SimConfig describes the simulated house. Temperatures are in
+// Fahrenheit and rates are per hour, whatever units the thermostat is set
+// to display.
+type SimConfig struct {
+	Start           time.Time
+	Step            time.Duration
+	OutdoorTemp     float64
+	OutdoorHumidity float64
+	// LossRate is the fraction of the indoor/outdoor difference lost per
+	// hour.
+	LossRate float64
+	// HeatRate and CoolRate are the degrees per hour added or removed by
+	// each active stage.
+	HeatRate float64
+	CoolRate float64
+	// Differential is how far the space temperature must pass a setpoint
+	// before a stage turns on, and Stage2Offset how far before the second
+	// stage joins in.
+	Differential float64
+	Stage2Offset float64
+	// HumidifyRate and DehumidifyRate are percentage points per hour of
+	// humidifier or cooling runtime.
+	HumidifyRate   float64
+	DehumidifyRate float64
+	IndoorHiAlert  float64
+	IndoorLoAlert  float64
+	// FilterHours is the blower runtime after which the filter alert
+	// fires.
+	FilterHours float64
+}
+
+func (cfg *SimConfig) setDefaults() {
+	if cfg.Start.IsZero() {
+		cfg.Start = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if cfg.Step <= 0 {
+		cfg.Step = time.Minute
+	}
+	if cfg.LossRate == 0 {
+		cfg.LossRate = 0.1
+	}
+	if cfg.HeatRate == 0 {
+		cfg.HeatRate = 6
+	}
+	if cfg.CoolRate == 0 {
+		cfg.CoolRate = 5
+	}
+	if cfg.Differential == 0 {
+		cfg.Differential = 1
+	}
+	if cfg.Stage2Offset == 0 {
+		cfg.Stage2Offset = 3
+	}
+	if cfg.HumidifyRate == 0 {
+		cfg.HumidifyRate = 4
+	}
+	if cfg.DehumidifyRate == 0 {
+		cfg.DehumidifyRate = 3
+	}
+	if cfg.IndoorHiAlert == 0 {
+		cfg.IndoorHiAlert = 90
+	}
+	if cfg.IndoorLoAlert == 0 {
+		cfg.IndoorLoAlert = 45
+	}
+	if cfg.FilterHours == 0 {
+		cfg.FilterHours = 500
+	}
+}
+
+// Simulation drives a Server like a house heated and cooled by the
+// thermostat, on a virtual clock that only moves when Advance is called.
+type Simulation struct {
+	server      *Server
+	mu          sync.Mutex
+	cfg         SimConfig
+	now         time.Time
+	indoor      float64
+	humidity    float64
+	filterRun   time.Duration
+	filterSince time.Time
+	overrideAt  time.Duration
+}
+
+// NewSimulation starts simulating from the server's current state.
+func NewSimulation(server *Server, cfg SimConfig) *Simulation {
+	cfg.setDefaults()
+	info := server.Info()
+	return &Simulation{
+		server:      server,
+		cfg:         cfg,
+		now:         cfg.Start,
+		indoor:      venstar.Temperature{Value: info.SpaceTemp, Units: info.TempUnits}.Fahrenheit(),
+		humidity:    info.Humidity,
+		filterSince: cfg.Start,
+	}
+}
+
+func (sim *Simulation) Now() time.Time {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return sim.now
+}
+
+func (sim *Simulation) SetOutdoorTemp(temp float64) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.cfg.OutdoorTemp = temp
+}
+
+func (sim *Simulation) SetOutdoorHumidity(humidity float64) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.cfg.OutdoorHumidity = humidity
+}
+
+// IndoorTemp returns the unrounded simulated space temperature in
+// Fahrenheit.
+func (sim *Simulation) IndoorTemp() float64 {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return sim.indoor
+}
+
+// Advance moves the virtual clock forward by d in fixed steps, updating
+// the thermostat state, sensors, runtimes and alerts as it goes.
+func (sim *Simulation) Advance(d time.Duration) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	for d > 0 {
+		step := sim.cfg.Step
+		if step > d {
+			step = d
+		}
+		sim.step(step)
+		d -= step
+	}
+}
+
+func (sim *Simulation) step(dt time.Duration) {
+	s := sim.server
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := &s.info
+	hours := dt.Hours()
+	units := info.TempUnits
+	toF := func(v float64) float64 {
+		return venstar.Temperature{Value: v, Units: units}.Fahrenheit()
+	}
+	heatSP := toF(info.HeatTemp)
+	coolSP := toF(info.CoolTemp)
+
+	heating := info.State == venstar.StateHeating
+	cooling := info.State == venstar.StateCooling
+	canHeat := info.Mode == venstar.ModeHeat || info.Mode == venstar.ModeAuto
+	canCool := info.Mode == venstar.ModeCool || info.Mode == venstar.ModeAuto
+	switch {
+	case !canHeat:
+		heating = false
+	case heating && sim.indoor >= heatSP+sim.cfg.Differential:
+		heating = false
+	case !heating && sim.indoor <= heatSP-sim.cfg.Differential:
+		heating = true
+	}
+	switch {
+	case !canCool || heating:
+		cooling = false
+	case cooling && sim.indoor <= coolSP-sim.cfg.Differential:
+		cooling = false
+	case !cooling && sim.indoor >= coolSP+sim.cfg.Differential:
+		cooling = true
+	}
+	stages := 0.0
+	switch {
+	case heating:
+		info.State = venstar.StateHeating
+		info.ActiveStage = venstar.StageHeating1
+		stages = 1
+		if sim.indoor <= heatSP-sim.cfg.Stage2Offset {
+			info.ActiveStage = venstar.StageHeating2
+			stages = 2
+		}
+	case cooling:
+		info.State = venstar.StateCooling
+		info.ActiveStage = venstar.StageCooling1
+		stages = 1
+		if sim.indoor >= coolSP+sim.cfg.Stage2Offset {
+			info.ActiveStage = venstar.StageCooling2
+			stages = 2
+		}
+	default:
+		info.State = venstar.StateIdle
+		info.ActiveStage = venstar.StageOff
+	}
+	running := heating || cooling
+	if running || info.FanSetting == venstar.FanSettingOn {
+		info.FanState = venstar.FanStateOn
+	} else {
+		info.FanState = venstar.FanStateOff
+	}
+
+	delta := -sim.cfg.LossRate * (sim.indoor - sim.cfg.OutdoorTemp)
+	if heating {
+		delta += sim.cfg.HeatRate * stages
+	} else if cooling {
+		delta -= sim.cfg.CoolRate * stages
+	}
+	sim.indoor += delta * hours
+
+	info.Humidifier = venstar.HumidifierOff
+	sim.humidity += sim.cfg.LossRate * (sim.cfg.OutdoorHumidity - sim.humidity) * hours
+	if heating && info.HumidifySetpoint > 0 && sim.humidity < info.HumidifySetpoint {
+		info.Humidifier = venstar.HumidifierOn
+		sim.humidity += sim.cfg.HumidifyRate * hours
+	}
+	if cooling {
+		sim.humidity -= sim.cfg.DehumidifyRate * stages * hours
+	}
+	sim.humidity = math.Max(0, math.Min(100, sim.humidity))
+
+	info.SpaceTemp = venstar.F(sim.indoor).In(units).Round().Value
+	info.Humidity = math.Round(sim.humidity)
+	for _, sensor := range s.sensors {
+		switch {
+		case sensor.Type == venstar.SensorTypeOutdoor:
+			sensor.Temp = venstar.F(sim.cfg.OutdoorTemp).In(units).Round().Value
+			sensor.Humidity = math.Round(sim.cfg.OutdoorHumidity)
+		case sensor.Type == "" || sensor.Type == venstar.SensorTypeRemote:
+			sensor.Temp = info.SpaceTemp
+			if sensor.Humidity != 0 {
+				sensor.Humidity = info.Humidity
+			}
+		}
+	}
+
+	if info.Override == venstar.OverrideStateOn {
+		sim.overrideAt += dt
+		for sim.overrideAt >= time.Minute && info.OverrideTime > 0 {
+			sim.overrideAt -= time.Minute
+			info.OverrideTime--
+		}
+		if info.OverrideTime == 0 {
+			info.Override = venstar.OverrideStateOff
+			sim.overrideAt = 0
+		}
+	}
+
+	start := sim.now
+	sim.now = sim.now.Add(dt)
+	sim.recordRuntime(start, dt, heating, cooling, stages, info.FanState == venstar.FanStateOn)
+
+	sim.setAlert("indoorHi", sim.indoor >= sim.cfg.IndoorHiAlert)
+	sim.setAlert("indoorLo", sim.indoor <= sim.cfg.IndoorLoAlert)
+	sim.setAlert("filterHr", sim.filterRun.Hours() >= sim.cfg.FilterHours)
+	sim.setAlert("Air Filter", sim.filterRun.Hours() >= sim.cfg.FilterHours)
+}
+
+// recordRuntime adds the step to the runtime entry for the day it started
+// on, keeping the last seven days like the firmware does. Runtimes are in
+// minutes. Must be called with the server locked.
+func (sim *Simulation) recordRuntime(start time.Time, dt time.Duration, heating, cooling bool, stages float64, fan bool) {
+	s := sim.server
+	y, m, d := start.Date()
+	day := float64(time.Date(y, m, d, 0, 0, 0, 0, start.Location()).Unix())
+	var today *venstar.RuntimeInfo
+	if n := len(s.runtimes); n > 0 && s.runtimes[n-1].Timestamp == day {
+		today = s.runtimes[n-1]
+	} else {
+		today = &venstar.RuntimeInfo{Timestamp: day}
+		s.runtimes = append(s.runtimes, today)
+		if len(s.runtimes) > 7 {
+			s.runtimes = s.runtimes[len(s.runtimes)-7:]
+		}
+	}
+	minutes := dt.Minutes()
+	if heating {
+		today.Heat += minutes
+		today.HeatStage1 += minutes
+		if stages > 1 {
+			today.HeatStage2 += minutes
+		}
+	}
+	if cooling {
+		today.Cool += minutes
+		today.CoolStage1 += minutes
+		if stages > 1 {
+			today.CoolStage2 += minutes
+		}
+	}
+	if fan {
+		sim.filterRun += dt
+	}
+	today.FilterHours = math.Floor(sim.filterRun.Hours())
+	today.FilterDays = math.Floor(sim.now.Sub(sim.filterSince).Hours() / 24)
+}
+
+// ResetFilter clears the filter runtime and alerts and restarts the count
+// of days since the filter was changed.
+func (sim *Simulation) ResetFilter() {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.server.mu.Lock()
+	defer sim.server.mu.Unlock()
+	sim.filterRun = 0
+	sim.filterSince = sim.now
+	sim.setAlert("filterHr", false)
+	sim.setAlert("Air Filter", false)
+}
+
+// setAlert must be called with the server locked.
+func (sim *Simulation) setAlert(name string, active bool) {
+	for _, alert := range sim.server.alerts {
+		if alert.Name == name {
+			alert.Active = active
+			return
+		}
+	}
+}
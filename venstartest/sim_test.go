@@ -0,0 +1,94 @@
+package venstartest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestSimulationRuntimesByDay(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sim := venstartest.NewSimulation(srv, venstartest.SimConfig{Start: start, OutdoorTemp: 20})
+	sim.Advance(48 * time.Hour)
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtimes, err := dev.Runtimes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runtimes) != 2 {
+		t.Fatalf("got %d runtime entries for 48 hours, want 2", len(runtimes))
+	}
+	for i, rt := range runtimes {
+		day := start.AddDate(0, 0, i)
+		if ts := time.Unix(int64(rt.Timestamp), 0).UTC(); !ts.Equal(day) {
+			t.Errorf("entry %d is for %s, want %s", i, ts, day)
+		}
+		if rt.Heat <= 0 || rt.Heat > 24*60 {
+			t.Errorf("entry %d heat runtime %g minutes", i, rt.Heat)
+		}
+	}
+	if sim.IndoorTemp() < 60 {
+		t.Errorf("indoor temperature fell to %g while heating", sim.IndoorTemp())
+	}
+}
+
+func TestSimulationResetFilter(t *testing.T) {
+	srv := venstartest.NewServer(venstartest.WithInfo(venstar.DeviceInfo{
+		Name:          "HALL",
+		Mode:          venstar.ModeAuto,
+		FanSetting:    venstar.FanSettingOn,
+		SpaceTemp:     70,
+		HeatTemp:      68,
+		CoolTemp:      76,
+		HeatTempMin:   35,
+		HeatTempMax:   99,
+		CoolTempMin:   35,
+		CoolTempMax:   99,
+		SetPointDelta: 2,
+	}))
+	defer srv.Close()
+	sim := venstartest.NewSimulation(srv, venstartest.SimConfig{OutdoorTemp: 70, FilterHours: 48})
+	sim.Advance(72 * time.Hour)
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := func() *venstar.RuntimeInfo {
+		t.Helper()
+		runtimes, err := dev.Runtimes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runtimes[len(runtimes)-1]
+	}
+	if rt := last(); rt.FilterDays != 3 || rt.FilterHours != 72 {
+		t.Errorf("filter used %g days, %g hours; want 3 days, 72 hours", rt.FilterDays, rt.FilterHours)
+	}
+	alerts, err := dev.Alerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alerts["filterHr"].Active {
+		t.Error("filter alert not active after 72 hours of fan")
+	}
+
+	sim.ResetFilter()
+	sim.Advance(25 * time.Hour)
+	if rt := last(); rt.FilterDays != 1 || rt.FilterHours != 25 {
+		t.Errorf("filter used %g days, %g hours after reset; want 1 day, 25 hours", rt.FilterDays, rt.FilterHours)
+	}
+	alerts, err = dev.Alerts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alerts["filterHr"].Active {
+		t.Error("filter alert still active after reset")
+	}
+}
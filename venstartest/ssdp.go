@@ -0,0 +1,194 @@
+package venstartest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const venstarST = "venstar:thermostat:ecp"
+
+// SSDPResponse is one reply the fake responder sends to each M-SEARCH.
+// If Raw is set it is sent verbatim, which allows malformed replies.
+type SSDPResponse struct {
+	ST       string
+	Location string
+	USN      string
+	MaxAge   int
+	Raw      []byte
+}
+
+// VenstarResponse returns a well formed thermostat reply.
+func VenstarResponse(location, mac, name, typ string) SSDPResponse {
+	return SSDPResponse{
+		ST:       venstarST,
+		Location: location,
+		USN:      fmt.Sprintf("ecp:%s:name:%s:type:%s", mac, name, typ),
+		MaxAge:   300,
+	}
+}
+
+// NonVenstarResponse returns a reply from some other UPnP device.
+func NonVenstarResponse(location string) SSDPResponse {
+	return SSDPResponse{
+		ST:       "upnp:rootdevice",
+		Location: location,
+		USN:      "uuid:2f402f80-da50-11e1-9b23-001788255acc::upnp:rootdevice",
+		MaxAge:   1800,
+	}
+}
+
+// MalformedResponse returns a reply that is not a valid HTTP response.
+func MalformedResponse() SSDPResponse {
+	return SSDPResponse{Raw: []byte("HTTP/1.1 garbage\r\nST venstar:thermostat:ecp\r\n")}
+}
+
+// SSDPResponse returns a thermostat reply pointing at the fake server.
+func (s *Server) SSDPResponse(mac string) SSDPResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return VenstarResponse(s.URL+"/", mac, s.info.Name, string(s.caps.Type))
+}
+
+func (resp SSDPResponse) bytes() []byte {
+	if resp.Raw != nil {
+		return resp.Raw
+	}
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("HTTP/1.1 200 OK\r\n")
+	if resp.MaxAge > 0 {
+		fmt.Fprintf(buf, "Cache-Control: max-age=%d\r\n", resp.MaxAge)
+	}
+	fmt.Fprintf(buf, "ST: %s\r\n", resp.ST)
+	fmt.Fprintf(buf, "Location: %s\r\n", resp.Location)
+	fmt.Fprintf(buf, "USN: %s\r\n", resp.USN)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// SSDPResponder is a fake SSDP responder on loopback that answers
+// M-SEARCH requests. Point venstar.Discoverer.Target at Addr to use it.
+type SSDPResponder struct {
+	conn      net.PacketConn
+	mu        sync.Mutex
+	responses []SSDPResponse
+	searches  []http.Header
+	done      chan struct{}
+}
+
+func NewSSDPResponder(responses ...SSDPResponse) (*SSDPResponder, error) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &SSDPResponder{
+		conn:      conn,
+		responses: responses,
+		done:      make(chan struct{}),
+	}
+	go r.serve()
+	return r, nil
+}
+
+func (r *SSDPResponder) Addr() *net.UDPAddr {
+	return r.conn.LocalAddr().(*net.UDPAddr)
+}
+
+func (r *SSDPResponder) AddResponse(resp SSDPResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, resp)
+}
+
+// Searches returns the headers of every M-SEARCH received so far.
+func (r *SSDPResponder) Searches() []http.Header {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]http.Header(nil), r.searches...)
+}
+
+func (r *SSDPResponder) Close() error {
+	err := r.conn.Close()
+	<-r.done
+	return err
+}
+
+func (r *SSDPResponder) serve() {
+	defer close(r.done)
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		header, ok := parseSearch(buf[:n])
+		if !ok {
+			continue
+		}
+		st := header.Get("ST")
+		r.mu.Lock()
+		r.searches = append(r.searches, header)
+		responses := append([]SSDPResponse(nil), r.responses...)
+		r.mu.Unlock()
+		for _, resp := range responses {
+			if resp.Raw == nil && st != "ssdp:all" && !strings.EqualFold(st, resp.ST) {
+				continue
+			}
+			r.conn.WriteTo(resp.bytes(), addr)
+		}
+	}
+}
+
+// Alive sends a NOTIFY ssdp:alive announcement for resp to addr, which is
+// normally where a venstar.Discoverer is monitoring.
+func (r *SSDPResponder) Alive(addr *net.UDPAddr, resp SSDPResponse) error {
+	return r.notify(addr, resp, "ssdp:alive")
+}
+
+// ByeBye sends a NOTIFY ssdp:byebye announcement for resp to addr.
+func (r *SSDPResponder) ByeBye(addr *net.UDPAddr, resp SSDPResponse) error {
+	return r.notify(addr, resp, "ssdp:byebye")
+}
+
+func (r *SSDPResponder) notify(addr *net.UDPAddr, resp SSDPResponse, nts string) error {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("NOTIFY * HTTP/1.1\r\n")
+	fmt.Fprintf(buf, "Host: %s\r\n", addr)
+	if resp.MaxAge > 0 && nts == "ssdp:alive" {
+		fmt.Fprintf(buf, "Cache-Control: max-age=%d\r\n", resp.MaxAge)
+	}
+	fmt.Fprintf(buf, "NT: %s\r\n", resp.ST)
+	fmt.Fprintf(buf, "NTS: %s\r\n", nts)
+	if nts == "ssdp:alive" {
+		fmt.Fprintf(buf, "Location: %s\r\n", resp.Location)
+	}
+	fmt.Fprintf(buf, "USN: %s\r\n", resp.USN)
+	buf.WriteString("\r\n")
+	_, err := r.conn.WriteTo(buf.Bytes(), addr)
+	return err
+}
+
+// parseSearch parses an M-SEARCH request leniently, since clients do not
+// all terminate it with a proper blank line.
+func parseSearch(msg []byte) (http.Header, bool) {
+	sc := bufio.NewScanner(bytes.NewReader(msg))
+	if !sc.Scan() || !strings.HasPrefix(sc.Text(), "M-SEARCH ") {
+		return nil, false
+	}
+	header := http.Header{}
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			break
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if ok {
+			header.Add(strings.TrimSpace(key), strings.TrimSpace(val))
+		}
+	}
+	return header, true
+}
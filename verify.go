@@ -0,0 +1,157 @@
+package venstar
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Mismatch describes a field whose value read back from the device
+// differs from the value written.
+type Mismatch struct {
+	Field     string
+	Requested any
+	Actual    any
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s requested %v, got %v", m.Field, m.Requested, m.Actual)
+}
+
+// tempTolerance is half the setpoint resolution of the units.
+func tempTolerance(units TempUnits) float64 {
+	if units == Celsius {
+		return 0.25
+	}
+	return 0.5
+}
+
+func (msg ControlMessage) mismatches(info *DeviceInfo) []Mismatch {
+	var out []Mismatch
+	if msg.Mode != info.Mode {
+		out = append(out, Mismatch{Field: "mode", Requested: msg.Mode, Actual: info.Mode})
+	}
+	if msg.Fan != info.FanSetting {
+		out = append(out, Mismatch{Field: "fan", Requested: msg.Fan, Actual: info.FanSetting})
+	}
+	tol := tempTolerance(info.TempUnits)
+	if math.Abs(msg.HeatTemp-info.HeatTemp) > tol {
+		out = append(out, Mismatch{Field: "heattemp", Requested: msg.HeatTemp, Actual: info.HeatTemp})
+	}
+	if math.Abs(msg.CoolTemp-info.CoolTemp) > tol {
+		out = append(out, Mismatch{Field: "cooltemp", Requested: msg.CoolTemp, Actual: info.CoolTemp})
+	}
+	return append(out, extraMismatches(msg.Extra, info)...)
+}
+
+func (msg SettingsMessage) mismatches(info *DeviceInfo) []Mismatch {
+	var out []Mismatch
+	if msg.TempUnits != info.TempUnits {
+		out = append(out, Mismatch{Field: "tempunits", Requested: msg.TempUnits, Actual: info.TempUnits})
+	}
+	if msg.Schedule != info.Schedule {
+		out = append(out, Mismatch{Field: "schedule", Requested: msg.Schedule, Actual: info.Schedule})
+	}
+	if math.Abs(msg.HumidifySetpoint-info.HumidifySetpoint) > 0.5 {
+		out = append(out, Mismatch{Field: "hum_setpoint", Requested: msg.HumidifySetpoint, Actual: info.HumidifySetpoint})
+	}
+	if math.Abs(msg.DehumidifySetpoint-info.DehumidifySetpoint) > 0.5 {
+		out = append(out, Mismatch{Field: "dehum_setpoint", Requested: msg.DehumidifySetpoint, Actual: info.DehumidifySetpoint})
+	}
+	if msg.Away != nil && *msg.Away != info.Away {
+		out = append(out, Mismatch{Field: "away", Requested: *msg.Away, Actual: info.Away})
+	}
+	if msg.Holiday != nil && *msg.Holiday != info.Holiday {
+		out = append(out, Mismatch{Field: "holiday", Requested: *msg.Holiday, Actual: info.Holiday})
+	}
+	if msg.Override != nil && *msg.Override != info.Override {
+		out = append(out, Mismatch{Field: "override", Requested: *msg.Override, Actual: info.Override})
+	}
+	if msg.ForceUnocc != nil && *msg.ForceUnocc != info.ForceUnocc {
+		out = append(out, Mismatch{Field: "forceunocc", Requested: *msg.ForceUnocc, Actual: info.ForceUnocc})
+	}
+	return append(out, extraMismatches(msg.Extra, info)...)
+}
+
+// extraMismatches compares passthrough fields against the device info,
+// skipping any the device does not report back.
+func extraMismatches(extra url.Values, info *DeviceInfo) []Mismatch {
+	var out []Mismatch
+	for name := range extra {
+		raw, ok := info.Extra[name]
+		if !ok {
+			continue
+		}
+		actual, ok := formValue(raw)
+		if !ok {
+			continue
+		}
+		requested := extra.Get(name)
+		if actual == requested {
+			continue
+		}
+		a, aerr := strconv.ParseFloat(actual, 64)
+		r, rerr := strconv.ParseFloat(requested, 64)
+		if aerr == nil && rerr == nil && a == r {
+			continue
+		}
+		out = append(out, Mismatch{Field: name, Requested: requested, Actual: actual})
+	}
+	return out
+}
+
+// pendingWrite is a message to post to path, with a check that lists the
+// fields the device has not applied.
+type pendingWrite struct {
+	path  string
+	msg   any
+	check func(*DeviceInfo) []Mismatch
+}
+
+// write posts the messages and, in verify mode, checks the result and
+// resends the ones that were not applied.
+func (dev *Device) write(ctx context.Context, writes ...pendingWrite) error {
+	for attempt := 0; ; attempt++ {
+		for _, w := range writes {
+			err := dev.post(ctx, []string{w.path}, w.msg)
+			if err != nil {
+				return err
+			}
+		}
+		if !dev.verify || len(writes) == 0 {
+			return nil
+		}
+		if dev.verifyDelay > 0 {
+			timer := time.NewTimer(dev.verifyDelay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		info, err := dev.InfoContext(ctx)
+		if err != nil {
+			return fmt.Errorf("error verifying write: %w", err)
+		}
+		var mismatches []Mismatch
+		var retry []pendingWrite
+		for _, w := range writes {
+			m := w.check(info)
+			if len(m) > 0 {
+				mismatches = append(mismatches, m...)
+				retry = append(retry, w)
+			}
+		}
+		if len(mismatches) == 0 {
+			return nil
+		}
+		if attempt >= dev.verifyRetries {
+			return &NotAppliedError{Mismatches: mismatches}
+		}
+		writes = retry
+	}
+}
@@ -0,0 +1,77 @@
+package venstar_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rclancey/venstar"
+	"github.com/rclancey/venstar/venstartest"
+)
+
+func TestVerifyResends(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL, venstar.WithVerify(2, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.DropWrites("/settings", 1)
+	err = dev.Update(func(c *venstar.ControlMessage, s *venstar.SettingsMessage) error {
+		c.Fan = venstar.FanSettingOn
+		s.Schedule = 1 - s.Schedule
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the write that was not applied is sent again
+	if n := len(srv.Forms("/control")); n != 1 {
+		t.Errorf("%d control writes, want 1", n)
+	}
+	if n := len(srv.Forms("/settings")); n != 2 {
+		t.Errorf("%d settings writes, want 2", n)
+	}
+}
+
+func TestVerifyNotApplied(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL, venstar.WithVerify(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.DropWrites("/control", -1)
+	err = dev.SetFanMode(venstar.FanSettingOn)
+	if !errors.Is(err, venstar.ErrNotApplied) {
+		t.Fatalf("SetFanMode = %v, want ErrNotApplied", err)
+	}
+	var nerr *venstar.NotAppliedError
+	if !errors.As(err, &nerr) || len(nerr.Mismatches) != 1 {
+		t.Fatalf("SetFanMode = %#v, want one mismatch", err)
+	}
+	m := nerr.Mismatches[0]
+	if m.Field != "fan" || m.Requested != venstar.FanSettingOn || m.Actual != venstar.FanSettingAuto {
+		t.Errorf("mismatch %s, want fan requested on, got auto", m)
+	}
+	if n := len(srv.Forms("/control")); n != 3 {
+		t.Errorf("%d control writes, want 1 and 2 retries", n)
+	}
+}
+
+func TestWithoutVerify(t *testing.T) {
+	srv := venstartest.NewServer()
+	defer srv.Close()
+	dev, err := venstar.Open(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.DropWrites("/control", -1)
+	err = dev.SetFanMode(venstar.FanSettingOn)
+	if err != nil {
+		t.Errorf("SetFanMode = %v, want the device's success reported", err)
+	}
+	if n := len(srv.Forms("/control")); n != 1 {
+		t.Errorf("%d control writes, want 1", n)
+	}
+}